@@ -0,0 +1,362 @@
+package catalog
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ManifestFile is the name of the catalog manifest inside the dumps directory
+const ManifestFile = "catalog.json"
+
+// timestampFormat is used in dump IDs and file names, milliseconds are appended to it
+const timestampFormat = "20060102-150405"
+
+// Entry describes a single dump stored in the dumps directory
+type Entry struct {
+	ID          string    `json:"id"`
+	Environment string    `json:"environment"`
+	File        string    `json:"file"` // path relative to dumps directory
+	Format      string    `json:"format"`
+	Compression string    `json:"compression,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	Size        int64     `json:"size"`
+	Checksum    string    `json:"checksum"`         // sha256 of dump contents
+	Masked      bool      `json:"masked,omitempty"` // masking rules were applied when dumping
+	Subset      string    `json:"subset,omitempty"` // subset definition for partial dumps
+	Label       string    `json:"label,omitempty"`
+	Pinned      bool      `json:"pinned,omitempty"`
+
+	ServerVersion string `json:"server_version,omitempty"` // version of the source server, e.g. "16.2"
+}
+
+// FormatName returns format of the dump including compression, e.g. "plain+zstd"
+func (e Entry) FormatName() string {
+	if e.Compression != "" {
+		return e.Format + "+" + e.Compression
+	}
+	return e.Format
+}
+
+// Name returns the entry's label, falling back to its ID
+func (e Entry) Name() string {
+	if e.Label != "" {
+		return e.Label
+	}
+	return e.ID
+}
+
+// manifest is the on-disk representation of the catalog
+type manifest struct {
+	Dumps []Entry `json:"dumps"`
+}
+
+// Catalog keeps track of dumps stored in the dumps directory
+type Catalog struct {
+	dir      string
+	mu       sync.Mutex
+	reserved map[string]bool // IDs given out by NewEntry, guarded by mu
+}
+
+// New creates a catalog for the given dumps directory
+func New(dir string) *Catalog {
+	return &Catalog{dir: dir, reserved: make(map[string]bool)}
+}
+
+// NewEntry prepares an entry for a new dump of the environment.
+// The returned entry has ID, file name and creation time set; size and
+// checksum are filled in by Add once the dump is written. The ID stays
+// reserved until the entry is added or released.
+// IDs include milliseconds and get a numeric suffix if a dump with the ID
+// or its file already exists, so that dumps made at once don't overwrite each other.
+func (c *Catalog) NewEntry(environment string, format string, extension string) Entry {
+	now := time.Now()
+	base := fmt.Sprintf("%s-%s%03d", environment, now.Format(timestampFormat), now.Nanosecond()/int(time.Millisecond))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// An unreadable manifest is reported by Add
+	taken := make(map[string]bool)
+	if m, err := c.read(); err == nil {
+		for _, e := range m.Dumps {
+			taken[e.ID] = true
+		}
+	}
+
+	id := base
+	for n := 2; taken[id] || c.reserved[id] || exists(filepath.Join(c.dir, id+extension)); n++ {
+		id = fmt.Sprintf("%s-%d", base, n)
+	}
+	c.reserved[id] = true
+
+	return Entry{
+		ID:          id,
+		Environment: environment,
+		File:        id + extension,
+		Format:      format,
+		CreatedAt:   now,
+	}
+}
+
+// Release gives up the ID of an entry that won't be added, e.g. because its dump failed.
+// Releasing an added entry does nothing.
+func (c *Catalog) Release(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.reserved, id)
+}
+
+// Path returns the full path to the entry's dump
+func (c *Catalog) Path(e Entry) string {
+	return filepath.Join(c.dir, e.File)
+}
+
+// Add computes size and checksum of the written dump and records it in the manifest
+func (c *Catalog) Add(e Entry) (Entry, error) {
+	size, checksum, err := measure(c.Path(e))
+	if err != nil {
+		return e, fmt.Errorf("error reading dump %s: %w", e.File, err)
+	}
+	e.Size = size
+	e.Checksum = checksum
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	m, err := c.read()
+	if err != nil {
+		return e, err
+	}
+	for _, existing := range m.Dumps {
+		if existing.ID == e.ID || existing.File == e.File {
+			return e, fmt.Errorf("dump %s is already in the catalog", e.ID)
+		}
+	}
+	delete(c.reserved, e.ID)
+	m.Dumps = append(m.Dumps, e)
+	return e, c.write(m)
+}
+
+// List returns dumps of the environment, newest first.
+// Empty environment name returns dumps of all environments.
+func (c *Catalog) List(environment string) ([]Entry, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	m, err := c.read()
+	if err != nil {
+		return nil, err
+	}
+
+	var result []Entry
+	for _, e := range m.Dumps {
+		if environment == "" || e.Environment == environment {
+			result = append(result, e)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt.After(result[j].CreatedAt)
+	})
+
+	return result, nil
+}
+
+// Latest returns the newest dump of the environment
+func (c *Catalog) Latest(environment string) (Entry, error) {
+	entries, err := c.List(environment)
+	if err != nil {
+		return Entry{}, err
+	}
+	if len(entries) == 0 {
+		return Entry{}, fmt.Errorf("no dumps found for environment %s", environment)
+	}
+	return entries[0], nil
+}
+
+// Get returns dump by ID
+func (c *Catalog) Get(id string) (Entry, error) {
+	entries, err := c.List("")
+	if err != nil {
+		return Entry{}, err
+	}
+	for _, e := range entries {
+		if e.ID == id {
+			return e, nil
+		}
+	}
+	return Entry{}, fmt.Errorf("dump not found: %s", id)
+}
+
+// Remove deletes the dump from disk and from the manifest
+func (c *Catalog) Remove(id string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	m, err := c.read()
+	if err != nil {
+		return err
+	}
+
+	for i, e := range m.Dumps {
+		if e.ID != id {
+			continue
+		}
+		m.Dumps = append(m.Dumps[:i], m.Dumps[i+1:]...)
+
+		// Catalogs written before IDs were unique may have entries sharing the file
+		if !usesFile(m.Dumps, e.File) {
+			if err := os.RemoveAll(c.Path(e)); err != nil {
+				return fmt.Errorf("error removing dump %s: %w", e.File, err)
+			}
+		}
+		return c.write(m)
+	}
+
+	return fmt.Errorf("dump not found: %s", id)
+}
+
+// Rename sets a human readable label for the dump, empty label resets it
+func (c *Catalog) Rename(id string, label string) error {
+	return c.update(id, func(e *Entry) {
+		e.Label = label
+	})
+}
+
+// SetPinned pins or unpins the dump
+func (c *Catalog) SetPinned(id string, pinned bool) error {
+	return c.update(id, func(e *Entry) {
+		e.Pinned = pinned
+	})
+}
+
+// update applies fn to the entry with given ID and saves the manifest
+func (c *Catalog) update(id string, fn func(e *Entry)) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	m, err := c.read()
+	if err != nil {
+		return err
+	}
+
+	for i := range m.Dumps {
+		if m.Dumps[i].ID == id {
+			fn(&m.Dumps[i])
+			return c.write(m)
+		}
+	}
+
+	return fmt.Errorf("dump not found: %s", id)
+}
+
+// read loads the manifest, a missing manifest is an empty catalog
+func (c *Catalog) read() (*manifest, error) {
+	data, err := os.ReadFile(filepath.Join(c.dir, ManifestFile))
+	if os.IsNotExist(err) {
+		return &manifest{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading dump catalog: %w", err)
+	}
+
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("error parsing dump catalog: %w", err)
+	}
+	return &m, nil
+}
+
+// write atomically replaces the manifest
+func (c *Catalog) write(m *manifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding dump catalog: %w", err)
+	}
+
+	path := filepath.Join(c.dir, ManifestFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("error writing dump catalog: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("error writing dump catalog: %w", err)
+	}
+	return nil
+}
+
+// usesFile reports whether any of the entries is stored in the file
+func usesFile(entries []Entry, file string) bool {
+	for _, e := range entries {
+		if e.File == file {
+			return true
+		}
+	}
+	return false
+}
+
+// exists reports whether the path exists
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// measure returns total size and sha256 checksum of a dump file or directory
+func measure(path string) (int64, string, error) {
+	hash := sha256.New()
+	var size int64
+
+	err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		// Include relative names so renamed files in directory dumps change the checksum
+		rel, err := filepath.Rel(path, p)
+		if err != nil {
+			return err
+		}
+		if rel != "." {
+			io.WriteString(hash, rel)
+		}
+
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		n, err := io.Copy(hash, f)
+		size += n
+		return err
+	})
+	if err != nil {
+		return 0, "", err
+	}
+
+	return size, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// FormatSize returns human readable size, e.g. "12.3 MB"
+func FormatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "KMGTPE"[exp])
+}
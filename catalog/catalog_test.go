@@ -0,0 +1,180 @@
+package catalog_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"dumper/catalog"
+)
+
+// writeDump creates the dump file of the entry
+func writeDump(t *testing.T, c *catalog.Catalog, e catalog.Entry, data string) {
+	t.Helper()
+	if err := os.WriteFile(c.Path(e), []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// addDump creates a new dump of the environment and records it
+func addDump(t *testing.T, c *catalog.Catalog, env string, data string) catalog.Entry {
+	t.Helper()
+	e := c.NewEntry(env, "plain", ".sql")
+	writeDump(t, c, e, data)
+	e, err := c.Add(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestNewEntryIDsAreUnique(t *testing.T) {
+	c := catalog.New(t.TempDir())
+
+	seen := make(map[string]bool)
+	for i := 0; i < 20; i++ {
+		e := addDump(t, c, "dev", "SELECT 1;\n")
+		if seen[e.ID] {
+			t.Fatalf("duplicate ID %s", e.ID)
+		}
+		seen[e.ID] = true
+		if e.File != e.ID+".sql" {
+			t.Errorf("unexpected file %s for %s", e.File, e.ID)
+		}
+	}
+
+	// Entries not added yet are unique too
+	first, second := c.NewEntry("dev", "plain", ".sql"), c.NewEntry("dev", "plain", ".sql")
+	if first.ID == second.ID {
+		t.Errorf("pending entries share ID %s", first.ID)
+	}
+
+	entries, err := c.List("dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 20 {
+		t.Errorf("expected 20 dumps, got %d", len(entries))
+	}
+}
+
+func TestReleasedIDsCanBeReused(t *testing.T) {
+	c := catalog.New(t.TempDir())
+
+	// Entries made within the same millisecond only get a suffix while the ID is reserved
+	for i := 0; i < 50; i++ {
+		e := c.NewEntry("dev", "plain", ".sql")
+		if strings.Count(e.ID, "-") != 2 {
+			t.Fatalf("released ID still reserved, got %s", e.ID)
+		}
+		c.Release(e.ID)
+	}
+}
+
+func TestAddMeasuresDumpAndRejectsDuplicates(t *testing.T) {
+	c := catalog.New(t.TempDir())
+	e := addDump(t, c, "dev", "SELECT 1;\n")
+
+	if e.Size != 10 || len(e.Checksum) != 64 {
+		t.Errorf("expected size and checksum, got %d and %q", e.Size, e.Checksum)
+	}
+	if _, err := c.Add(e); err == nil {
+		t.Error("expected error adding the same dump twice")
+	}
+	if got, err := c.Get(e.ID); err != nil || got.Checksum != e.Checksum {
+		t.Errorf("expected recorded dump, got %+v, %v", got, err)
+	}
+
+	missing := c.NewEntry("dev", "plain", ".sql")
+	if _, err := c.Add(missing); err == nil {
+		t.Error("expected error adding a dump without file")
+	}
+}
+
+func TestRemoveDeletesFileAndEntry(t *testing.T) {
+	c := catalog.New(t.TempDir())
+	old := addDump(t, c, "dev", "old")
+	latest := addDump(t, c, "dev", "latest")
+
+	if err := c.Remove(old.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(c.Path(old)); !os.IsNotExist(err) {
+		t.Errorf("dump file not removed: %v", err)
+	}
+	if _, err := c.Get(old.ID); err == nil {
+		t.Error("removed dump still in catalog")
+	}
+	if e, err := c.Latest("dev"); err != nil || e.ID != latest.ID {
+		t.Errorf("expected %s left, got %s, %v", latest.ID, e.ID, err)
+	}
+	if err := c.Remove(old.ID); err == nil {
+		t.Error("expected error removing unknown dump")
+	}
+}
+
+func TestRemoveKeepsFileSharedByOtherEntry(t *testing.T) {
+	dir := t.TempDir()
+	// Older catalogs could record two dumps made within one second in the same file
+	manifest := `{"dumps": [
+		{"id": "dev-20240101-120000", "environment": "dev", "file": "dev-20240101-120000.sql", "created_at": "2024-01-01T12:00:00Z"},
+		{"id": "dev-20240101-120000", "environment": "dev", "file": "dev-20240101-120000.sql", "created_at": "2024-01-01T12:00:00.5Z"}
+	]}`
+	if err := os.WriteFile(filepath.Join(dir, catalog.ManifestFile), []byte(manifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := catalog.New(dir)
+	file := filepath.Join(dir, "dev-20240101-120000.sql")
+	if err := os.WriteFile(file, []byte("SELECT 1;\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Remove("dev-20240101-120000"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(file); err != nil {
+		t.Errorf("file of the other entry removed: %v", err)
+	}
+	if err := c.Remove("dev-20240101-120000"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Errorf("file not removed with the last entry: %v", err)
+	}
+}
+
+func TestMissingManifestIsEmptyCatalog(t *testing.T) {
+	c := catalog.New(t.TempDir())
+
+	entries, err := c.List("")
+	if err != nil || len(entries) != 0 {
+		t.Errorf("expected empty catalog, got %v, %v", entries, err)
+	}
+	if _, err := c.Latest("dev"); err == nil {
+		t.Error("expected error for latest dump of empty catalog")
+	}
+}
+
+func TestCorruptManifestIsReported(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, catalog.ManifestFile), []byte("{not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := catalog.New(dir)
+
+	if _, err := c.List(""); err == nil || !strings.Contains(err.Error(), "error parsing dump catalog") {
+		t.Errorf("expected parse error, got %v", err)
+	}
+
+	// A dump isn't recorded over the corrupt manifest
+	e := c.NewEntry("dev", "plain", ".sql")
+	writeDump(t, c, e, "SELECT 1;\n")
+	if _, err := c.Add(e); err == nil {
+		t.Error("expected error adding to corrupt catalog")
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, catalog.ManifestFile))
+	if string(data) != "{not json" {
+		t.Errorf("corrupt manifest overwritten: %q", data)
+	}
+}
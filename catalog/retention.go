@@ -0,0 +1,65 @@
+package catalog
+
+import (
+	"time"
+)
+
+// Policy describes which dumps of an environment are kept by Prune.
+// Zero values mean no limit.
+type Policy struct {
+	KeepLast     int
+	MaxAge       time.Duration
+	MaxTotalSize int64
+}
+
+// Prune removes dumps of the environment that violate the policy and returns them.
+// Pinned dumps and the newest dump of the environment are never removed,
+// pinned dumps don't count towards KeepLast but do count towards MaxTotalSize.
+// With dryRun set the dumps are only selected, not removed.
+func (c *Catalog) Prune(environment string, policy Policy, dryRun bool) ([]Entry, error) {
+	entries, err := c.List(environment)
+	if err != nil {
+		return nil, err
+	}
+
+	// Pinned dumps always take their space, so count them first
+	var totalSize int64
+	for _, e := range entries {
+		if e.Pinned {
+			totalSize += e.Size
+		}
+	}
+
+	var expired []Entry
+	var kept int
+	now := time.Now()
+
+	for i, e := range entries {
+		if e.Pinned {
+			continue
+		}
+
+		newest := i == 0
+		if !newest && (policy.KeepLast > 0 && kept >= policy.KeepLast ||
+			policy.MaxAge > 0 && now.Sub(e.CreatedAt) > policy.MaxAge ||
+			policy.MaxTotalSize > 0 && totalSize+e.Size > policy.MaxTotalSize) {
+			expired = append(expired, e)
+			continue
+		}
+
+		kept++
+		totalSize += e.Size
+	}
+
+	if dryRun {
+		return expired, nil
+	}
+
+	for i, e := range expired {
+		if err := c.Remove(e.ID); err != nil {
+			return expired[:i], err
+		}
+	}
+
+	return expired, nil
+}
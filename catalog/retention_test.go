@@ -0,0 +1,160 @@
+package catalog_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"dumper/catalog"
+)
+
+// dump describes a dump created for a Prune test
+type dump struct {
+	age    time.Duration
+	size   int
+	pinned bool
+}
+
+// addDumps records the dumps of dev and returns their IDs
+func addDumps(t *testing.T, c *catalog.Catalog, dumps []dump) []string {
+	t.Helper()
+	ids := make([]string, len(dumps))
+	for i, d := range dumps {
+		e := c.NewEntry("dev", "plain", ".sql")
+		e.CreatedAt = time.Now().Add(-d.age)
+		writeDump(t, c, e, strings.Repeat("x", d.size))
+		e, err := c.Add(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.pinned {
+			if err := c.SetPinned(e.ID, true); err != nil {
+				t.Fatal(err)
+			}
+		}
+		ids[i] = e.ID
+	}
+	return ids
+}
+
+func TestPrune(t *testing.T) {
+	const day = 24 * time.Hour
+
+	tests := []struct {
+		name    string
+		dumps   []dump // newest first
+		policy  catalog.Policy
+		removed []int // indexes into dumps
+	}{
+		{
+			name:  "no limits",
+			dumps: []dump{{age: 1 * day}, {age: 2 * day}, {age: 300 * day}},
+		},
+		{
+			name:    "keep last",
+			dumps:   []dump{{age: 1 * day}, {age: 2 * day}, {age: 3 * day}, {age: 4 * day}},
+			policy:  catalog.Policy{KeepLast: 2},
+			removed: []int{2, 3},
+		},
+		{
+			name:    "max age",
+			dumps:   []dump{{age: 1 * day}, {age: 5 * day}, {age: 20 * day}, {age: 30 * day}},
+			policy:  catalog.Policy{MaxAge: 10 * day},
+			removed: []int{2, 3},
+		},
+		{
+			name:    "newest is always kept",
+			dumps:   []dump{{age: 40 * day}, {age: 50 * day}},
+			policy:  catalog.Policy{KeepLast: 1, MaxAge: 10 * day, MaxTotalSize: 1},
+			removed: []int{1},
+		},
+		{
+			name:    "pinned dumps are kept and don't count towards keep last",
+			dumps:   []dump{{age: 1 * day}, {age: 2 * day, pinned: true}, {age: 3 * day}, {age: 100 * day, pinned: true}, {age: 4 * day}},
+			policy:  catalog.Policy{KeepLast: 2, MaxAge: 10 * day},
+			removed: []int{4},
+		},
+		{
+			name:    "max total size",
+			dumps:   []dump{{age: 1 * day, size: 100}, {age: 2 * day, size: 100}, {age: 3 * day, size: 100}},
+			policy:  catalog.Policy{MaxTotalSize: 250},
+			removed: []int{2},
+		},
+		{
+			name:    "pinned dumps count towards max total size",
+			dumps:   []dump{{age: 1 * day, size: 100}, {age: 2 * day, size: 100, pinned: true}, {age: 3 * day, size: 100}},
+			policy:  catalog.Policy{MaxTotalSize: 250},
+			removed: []int{2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := catalog.New(t.TempDir())
+			ids := addDumps(t, c, tt.dumps)
+
+			expired, err := c.Prune("dev", tt.policy, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got, want []string
+			for _, e := range expired {
+				got = append(got, e.ID)
+			}
+			for _, i := range tt.removed {
+				want = append(want, ids[i])
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("removed %q, want %q", got, want)
+			}
+
+			entries, err := c.List("dev")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != len(ids)-len(want) {
+				t.Errorf("expected %d dumps left, got %d", len(ids)-len(want), len(entries))
+			}
+		})
+	}
+}
+
+func TestPruneDryRunKeepsDumps(t *testing.T) {
+	c := catalog.New(t.TempDir())
+	ids := addDumps(t, c, []dump{{age: time.Hour}, {age: 2 * time.Hour}, {age: 3 * time.Hour}})
+
+	expired, err := c.Prune("dev", catalog.Policy{KeepLast: 1}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expired) != 2 || expired[0].ID != ids[1] || expired[1].ID != ids[2] {
+		t.Errorf("expected the two older dumps, got %+v", expired)
+	}
+
+	entries, err := c.List("dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Errorf("dry run removed dumps, %d left", len(entries))
+	}
+}
+
+func TestPruneOnlyTouchesEnvironment(t *testing.T) {
+	c := catalog.New(t.TempDir())
+	addDumps(t, c, []dump{{age: time.Hour}, {age: 2 * time.Hour}})
+	addDump(t, c, "prod", "SELECT 1;\n")
+	addDump(t, c, "prod", "SELECT 1;\n")
+
+	if _, err := c.Prune("dev", catalog.Policy{KeepLast: 1}, false); err != nil {
+		t.Fatal(err)
+	}
+	prod, err := c.List("prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prod) != 2 {
+		t.Errorf("dumps of other environment removed, %d left", len(prod))
+	}
+}
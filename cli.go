@@ -0,0 +1,352 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+
+	"dumper/catalog"
+	"dumper/config/env"
+	"dumper/database"
+	"dumper/migrations"
+)
+
+// usage prints help for the interactive mode and headless commands
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage:\n")
+	fmt.Fprintf(out, "  dumper [--debug]                                  start interactive UI\n")
+	fmt.Fprintf(out, "  dumper [--debug] dump --env <name> [--subset <s>] create dump of environment\n")
+	fmt.Fprintf(out, "  dumper [--debug] load --env <name> [--dump <id>]  load dump into local database (latest by default)\n")
+	fmt.Fprintf(out, "  dumper [--debug] copy --env <name> [--subset <s>] stream database into local database, no dump file\n")
+	fmt.Fprintf(out, "  dumper list [--env <name>]                        list dumps in the catalog\n")
+	fmt.Fprintf(out, "  dumper prune [--env <name>] [--dry-run]           remove dumps according to retention settings\n")
+	fmt.Fprintf(out, "  dumper [--debug] migrate --env <name> --to <ver>  migrate local database (version or \"latest\")\n")
+	fmt.Fprintf(out, "  dumper [--debug] refresh --env <name> [--pipeline <p>]\n")
+	fmt.Fprintf(out, "                                                    dump, load, migrate and verify, or run pipeline p\n")
+	fmt.Fprintf(out, "  dumper container <action> [--env <name>] [--yes]  manage local container: status, start, stop,\n")
+	fmt.Fprintf(out, "                                                    restart, recreate or destroy (with volume)\n")
+	fmt.Fprintf(out, "\nFlags:\n")
+	flag.PrintDefaults()
+}
+
+// runCommand executes a headless command without starting the UI.
+// Ctrl+C cancels a running dump, load, copy or migration and cleans up after it.
+func (a *application) runCommand(args []string) error {
+	name, args := args[0], args[1:]
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	switch name {
+	case "dump":
+		return a.runDump(ctx, args)
+	case "load":
+		return a.runLoad(ctx, args)
+	case "copy":
+		return a.runCopy(ctx, args)
+	case "list":
+		return a.runList(args)
+	case "prune":
+		return a.runPrune(args)
+	case "migrate":
+		return a.runMigrate(ctx, args)
+	case "refresh":
+		return a.runRefresh(ctx, args)
+	case "container":
+		return a.runContainer(args)
+	case "help":
+		usage()
+		return nil
+	default:
+		usage()
+		return fmt.Errorf("unknown command: %s", name)
+	}
+}
+
+func (a *application) runDump(ctx context.Context, args []string) error {
+	fs := newFlagSet("dump")
+	envName := fs.String("env", "", "Environment to dump")
+	subset := fs.String("subset", "", "Dump only rows reachable from \"<table> where <condition>\"")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	e, err := a.selectEnvironment(*envName)
+	if err != nil {
+		return err
+	}
+
+	logf("Creating dump of %s...", e.Name)
+	entry, err := a.dumpEnvironment(ctx, e, *subset, nil)
+	if err != nil {
+		return err
+	}
+	logf("Database dump completed successfully: %s (%s)", entry.ID, catalog.FormatSize(entry.Size))
+
+	return nil
+}
+
+func (a *application) runLoad(ctx context.Context, args []string) error {
+	fs := newFlagSet("load")
+	envName := fs.String("env", "", "Environment whose dump to load")
+	dumpID := fs.String("dump", "", "ID of the dump to load (latest by default)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	e, err := a.selectEnvironment(*envName)
+	if err != nil {
+		return err
+	}
+
+	logf("Loading dump into local database %s...", e.Name)
+	if err := a.loadEnvironment(ctx, e, *dumpID, nil); err != nil {
+		return err
+	}
+	logf("Dump loaded successfully!")
+
+	return nil
+}
+
+func (a *application) runCopy(ctx context.Context, args []string) error {
+	fs := newFlagSet("copy")
+	envName := fs.String("env", "", "Environment to copy")
+	subset := fs.String("subset", "", "Copy only rows reachable from \"<table> where <condition>\"")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	e, err := a.selectEnvironment(*envName)
+	if err != nil {
+		return err
+	}
+
+	logf("Copying %s into local database...", e.Name)
+	if err := a.copyEnvironment(ctx, e, *subset, nil); err != nil {
+		return err
+	}
+	logf("Database copied successfully!")
+
+	return nil
+}
+
+func (a *application) runList(args []string) error {
+	fs := newFlagSet("list")
+	envName := fs.String("env", "", "Only list dumps of this environment")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	entries, err := a.catalog.List(*envName)
+	if err != nil {
+		return err
+	}
+
+	if len(entries) == 0 {
+		logf("No dumps found")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tENVIRONMENT\tCREATED\tFORMAT\tSIZE\tSHA256")
+	for _, e := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%.12s\n",
+			e.ID, e.Environment, e.CreatedAt.Format("2006-01-02 15:04:05"),
+			e.FormatName(), catalog.FormatSize(e.Size), e.Checksum)
+	}
+	return w.Flush()
+}
+
+func (a *application) runPrune(args []string) error {
+	fs := newFlagSet("prune")
+	envName := fs.String("env", "", "Only prune dumps of this environment")
+	dryRun := fs.Bool("dry-run", false, "Only show dumps that would be removed")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	environments := a.cfg.GetEnvironments()
+	if *envName != "" {
+		e := a.cfg.GetEnvironment(*envName)
+		if e == nil {
+			return fmt.Errorf("environment not found: %s", *envName)
+		}
+		environments = []env.Environment{*e}
+	}
+
+	var total int
+	for i := range environments {
+		removed, err := a.pruneEnvironment(&environments[i], *dryRun)
+		if err != nil {
+			return fmt.Errorf("failed to prune dumps of %s: %w", environments[i].Name, err)
+		}
+		if *dryRun {
+			for _, entry := range removed {
+				logf("Would prune dump %s (%s)", entry.Name(), catalog.FormatSize(entry.Size))
+			}
+		}
+		total += len(removed)
+	}
+
+	logf("Pruned %d dump(s)", total)
+	return nil
+}
+
+func (a *application) runMigrate(ctx context.Context, args []string) error {
+	fs := newFlagSet("migrate")
+	envName := fs.String("env", "", "Environment whose migrations to apply")
+	to := fs.String("to", "", "Target version (migration timestamp or \"latest\")")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	e, err := a.selectEnvironment(*envName)
+	if err != nil {
+		return err
+	}
+
+	if e.MigrationsDir == "" {
+		return fmt.Errorf("migrations directory not specified for environment %s", e.Name)
+	}
+
+	version, err := parseVersion(*to, e.MigrationsDir)
+	if err != nil {
+		return err
+	}
+
+	logf("Starting migration to version %d...", version)
+	if err := migrations.MigrateTo(ctx, a.localDb.GetDSN(), e.MigrationsDir, version, logf); err != nil {
+		return fmt.Errorf("migration error: %w", err)
+	}
+	logf("Migration completed successfully!")
+
+	return nil
+}
+
+func (a *application) runRefresh(ctx context.Context, args []string) error {
+	fs := newFlagSet("refresh")
+	envName := fs.String("env", "", "Environment to refresh")
+	name := fs.String("pipeline", env.RefreshPipeline, "Pipeline from config to run")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	e, err := a.selectEnvironment(*envName)
+	if err != nil {
+		return err
+	}
+
+	pipeline, err := a.cfg.GetPipeline(*name)
+	if err != nil {
+		return err
+	}
+
+	logf("Running %s of %s...", pipeline.Name, e.Name)
+	return a.runPipeline(ctx, e, pipeline, nil)
+}
+
+func (a *application) runContainer(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("container action is required")
+	}
+	name, args := args[0], args[1:]
+
+	fs := newFlagSet("container " + name)
+	envName := fs.String("env", "", "Environment whose container to manage, required with per_environment")
+	yes := fs.Bool("yes", false, "Confirm destroying the container and its volume")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var e *env.Environment
+	if *envName != "" {
+		var err error
+		if e, err = a.selectEnvironment(*envName); err != nil {
+			return err
+		}
+	} else if a.cfg.GetLocal(nil).IsPerEnvironment() {
+		// Without an environment the shared container would be managed, which isn't used
+		return fmt.Errorf("--env is required with per_environment, every environment has its own container")
+	}
+
+	if name == "status" {
+		return a.printContainerStatus(e)
+	}
+
+	action, err := database.ParseContainerAction(name)
+	if err != nil {
+		return err
+	}
+	if action == database.ContainerDestroy && !*yes {
+		return fmt.Errorf("destroy removes all loaded databases, confirm with --yes")
+	}
+	return a.runContainerAction(e, action)
+}
+
+// printContainerStatus prints status and disk usage of the local container
+func (a *application) printContainerStatus(e *env.Environment) error {
+	status, err := database.GetContainerStatus(a.postgresConfig(e))
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Container:\t%s (%s)\n", status.Name, status.State)
+	fmt.Fprintf(w, "Image:\t%s\n", status.Image)
+	fmt.Fprintf(w, "Port:\t%d\n", status.Port)
+	fmt.Fprintf(w, "Volume:\t%s\n", status.Volume)
+	if status.DiskUsage >= 0 {
+		fmt.Fprintf(w, "Disk usage:\t%s\n", catalog.FormatSize(status.DiskUsage))
+	}
+	for _, db := range status.Databases {
+		fmt.Fprintf(w, "  %s\t%s\n", db.Name, catalog.FormatSize(db.Size))
+	}
+	return w.Flush()
+}
+
+// selectEnvironment finds environment by name and points local database at it
+func (a *application) selectEnvironment(name string) (*env.Environment, error) {
+	if name == "" {
+		return nil, fmt.Errorf("--env is required")
+	}
+
+	e := a.cfg.GetEnvironment(name)
+	if e == nil {
+		return nil, fmt.Errorf("environment not found: %s", name)
+	}
+
+	*a.localDb = *a.cfg.LocalConnection(e)
+	return e, nil
+}
+
+// parseVersion parses target migration version, resolving "latest"
+func parseVersion(value string, migrationsDir string) (int64, error) {
+	switch value {
+	case "":
+		return 0, fmt.Errorf("--to is required")
+	case "latest":
+		return migrations.LatestVersion(migrationsDir)
+	}
+
+	version, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid version %q: %w", value, err)
+	}
+	return version, nil
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	return flag.NewFlagSet("dumper "+name, flag.ContinueOnError)
+}
+
+// logf prints a log line to stdout
+func logf(format string, a ...interface{}) {
+	fmt.Fprintln(os.Stdout, strings.TrimRight(fmt.Sprintf(format, a...), "\n"))
+}
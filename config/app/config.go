@@ -3,16 +3,37 @@ package app
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
 
 	"gopkg.in/yaml.v2"
 
+	"dumper/config/db"
 	"dumper/config/env"
+	"dumper/container"
 )
 
 // Config represents the main application configuration
 type Config struct {
 	Environments *env.Config
 	DumpsDir     string
+	Retention    env.Retention
+	Local        env.Local
+	Pipelines    []env.Pipeline
+
+	// ports containers were published on instead of the configured ones,
+	// guarded by portsMu as background jobs save them
+	ports   map[string]savedPort
+	portsMu sync.Mutex
+}
+
+// fileConfig represents the layout of the YAML config file
+type fileConfig struct {
+	env.Config `yaml:",inline"`
+	Retention  env.Retention  `yaml:"retention"`
+	Local      env.Local      `yaml:"local"`
+	Pipelines  []env.Pipeline `yaml:"pipelines"`
 }
 
 // LoadConfig loads configuration from a YAML file
@@ -22,26 +43,75 @@ func LoadConfig(configPath string, dumpsDir string) (*Config, error) {
 		return nil, fmt.Errorf("error reading config file: %w", err)
 	}
 
-	var environments env.Config
-	if err := yaml.Unmarshal(data, &environments); err != nil {
+	var file fileConfig
+	if err := yaml.Unmarshal(data, &file); err != nil {
 		return nil, fmt.Errorf("error parsing config file: %w", err)
 	}
 
-	if len(environments.Environments) == 0 {
+	if len(file.Environments) == 0 {
 		return nil, fmt.Errorf("no environments found in config")
 	}
 
+	if err := validateLocal(file.Local); err != nil {
+		return nil, err
+	}
+	for _, e := range file.Environments {
+		if err := validateLocal(file.Local.Merge(e.Local)); err != nil {
+			return nil, fmt.Errorf("environment %s: %w", e.Name, err)
+		}
+		if err := e.Validate(); err != nil {
+			return nil, fmt.Errorf("environment %s: %w", e.Name, err)
+		}
+	}
+
+	names := make(map[string]bool)
+	for _, p := range file.Pipelines {
+		if p.Name == "" {
+			return nil, fmt.Errorf("pipeline without name")
+		}
+		if names[p.Name] {
+			return nil, fmt.Errorf("duplicate pipeline %s", p.Name)
+		}
+		names[p.Name] = true
+		if _, err := p.ParseSteps(); err != nil {
+			return nil, err
+		}
+	}
+
 	// Create dumps directory if it doesn't exist
 	if err := os.MkdirAll(dumpsDir, 0755); err != nil {
 		return nil, fmt.Errorf("error creating dumps directory: %w", err)
 	}
 
+	ports, err := loadPorts(dumpsDir)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Config{
-		Environments: &environments,
+		Environments: &file.Config,
 		DumpsDir:     dumpsDir,
+		Retention:    file.Retention,
+		Local:        file.Local,
+		Pipelines:    file.Pipelines,
+		ports:        ports,
 	}, nil
 }
 
+// validateLocal checks local database settings
+func validateLocal(local env.Local) error {
+	switch local.Mode {
+	case "", env.LocalModeContainer, env.LocalModeNative:
+	default:
+		return fmt.Errorf("unknown local mode %q: expected %s or %s",
+			local.Mode, env.LocalModeContainer, env.LocalModeNative)
+	}
+	if local.Port < 0 || local.Port > 65535 {
+		return fmt.Errorf("invalid local port %d", local.Port)
+	}
+	return container.ValidateRuntime(local.Runtime)
+}
+
 // GetEnvironment returns an environment by name
 func (c *Config) GetEnvironment(name string) *env.Environment {
 	return c.Environments.GetEnvironmentByName(name)
@@ -51,3 +121,104 @@ func (c *Config) GetEnvironment(name string) *env.Environment {
 func (c *Config) GetEnvironments() []env.Environment {
 	return c.Environments.Environments
 }
+
+// GetPipeline returns the pipeline by name. Refresh falls back to the default
+// dump, load, migrate and verify steps when it isn't configured.
+func (c *Config) GetPipeline(name string) (env.Pipeline, error) {
+	for _, p := range c.Pipelines {
+		if p.Name == name {
+			return p, nil
+		}
+	}
+	if name == env.RefreshPipeline {
+		return env.DefaultRefresh, nil
+	}
+	return env.Pipeline{}, fmt.Errorf("pipeline %s not found in config", name)
+}
+
+// GetRetention returns retention settings of the environment merged with global ones
+func (c *Config) GetRetention(e *env.Environment) env.Retention {
+	return c.Retention.Merge(e.Retention)
+}
+
+// GetLocal returns local database settings of the environment merged with global ones
+// and defaults. Nil environment returns global settings.
+func (c *Config) GetLocal(e *env.Environment) env.Local {
+	local := c.configuredLocal(e)
+
+	c.portsMu.Lock()
+	defer c.portsMu.Unlock()
+	if p, ok := c.ports[local.ContainerName]; ok && !local.IsNative() && p.Configured == local.Port {
+		local.Port = p.Port
+	}
+	return local
+}
+
+// configuredLocal returns local database settings as configured, without saved ports
+func (c *Config) configuredLocal(e *env.Environment) env.Local {
+	local := c.Local
+	if e == nil {
+		return local.WithDefaults()
+	}
+
+	local = local.Merge(e.Local).WithDefaults()
+	if !local.IsPerEnvironment() {
+		return local
+	}
+
+	// Settings given explicitly for the environment are kept
+	var override env.Local
+	if e.Local != nil {
+		override = *e.Local
+	}
+	if override.ContainerName == "" {
+		local.ContainerName += "_" + containerSuffix(e.Name)
+	}
+	// A native server is shared by all environments, only containers get own ports
+	if override.Port == 0 && !local.IsNative() {
+		local.Port += c.environmentIndex(e.Name)
+	}
+	if override.Volume == "" {
+		local.Volume = local.ContainerName + "_data"
+	}
+	return local
+}
+
+// environmentIndex returns position of the environment in config
+func (c *Config) environmentIndex(name string) int {
+	for i, e := range c.Environments.Environments {
+		if e.Name == name {
+			return i
+		}
+	}
+	return 0
+}
+
+// containerSuffix turns environment name into a valid container name part
+func containerSuffix(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '.' || r == '-' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// LocalConnection returns connection to the environment's database on the local server.
+// Nil environment connects to the postgres database.
+func (c *Config) LocalConnection(e *env.Environment) *db.Connection {
+	local := c.GetLocal(e)
+	database := "postgres"
+	if e != nil {
+		database = e.Name
+	}
+
+	return &db.Connection{
+		Host:     local.Host,
+		Port:     strconv.Itoa(local.Port),
+		User:     local.User,
+		Password: local.Password,
+		Database: database,
+		SslMode:  "disable",
+	}
+}
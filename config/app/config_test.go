@@ -0,0 +1,329 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"dumper/config/env"
+)
+
+func loadConfig(t *testing.T, yaml string) *Config {
+	t.Helper()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadConfig(path, filepath.Join(dir, "dumps"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func TestGetLocalPerEnvironment(t *testing.T) {
+	cfg := loadConfig(t, `
+local:
+  per_environment: true
+  port: 6000
+environments:
+  - name: dev
+    db_dsn: postgres://dev
+  - name: stage
+    db_dsn: postgres://stage
+  - name: prod
+    db_dsn: postgres://prod
+    local:
+      container_name: prod_db
+      port: 7000
+`)
+
+	tests := []struct {
+		env       string
+		container string
+		port      int
+		volume    string
+	}{
+		{"dev", "local_postgres_dev", 6000, "local_postgres_dev_data"},
+		{"stage", "local_postgres_stage", 6001, "local_postgres_stage_data"},
+		{"prod", "prod_db", 7000, "prod_db_data"},
+	}
+	for _, tt := range tests {
+		local := cfg.GetLocal(cfg.GetEnvironment(tt.env))
+		if local.ContainerName != tt.container || local.Port != tt.port || local.Volume != tt.volume {
+			t.Errorf("%s: got container %s, port %d, volume %s; want %s, %d, %s",
+				tt.env, local.ContainerName, local.Port, local.Volume, tt.container, tt.port, tt.volume)
+		}
+	}
+
+	if conn := cfg.LocalConnection(cfg.GetEnvironment("stage")); conn.Port != "6001" || conn.Database != "stage" {
+		t.Errorf("unexpected stage connection %+v", conn)
+	}
+	if dev, stage := cfg.GetLocal(cfg.GetEnvironment("dev")), cfg.GetLocal(cfg.GetEnvironment("stage")); dev.Target() == stage.Target() {
+		t.Errorf("own containers need own targets, got %s", dev.Target())
+	}
+}
+
+func TestGetLocalPerEnvironmentOptOut(t *testing.T) {
+	cfg := loadConfig(t, `
+local:
+  per_environment: true
+environments:
+  - name: dev
+    db_dsn: postgres://dev
+  - name: stage
+    db_dsn: postgres://stage
+    local:
+      per_environment: false
+`)
+
+	if local := cfg.GetLocal(cfg.GetEnvironment("dev")); local.ContainerName != "local_postgres_dev" {
+		t.Errorf("dev should get its own container, got %s", local.ContainerName)
+	}
+	if local := cfg.GetLocal(cfg.GetEnvironment("stage")); local.ContainerName != "local_postgres" || local.Port != 5432 {
+		t.Errorf("stage opted out of per-environment containers, got %s on port %d", local.ContainerName, local.Port)
+	}
+}
+
+func TestGetLocalMatchServerVersionOverride(t *testing.T) {
+	cfg := loadConfig(t, `
+local:
+  match_server_version: true
+environments:
+  - name: dev
+    db_dsn: postgres://dev
+  - name: prod
+    db_dsn: postgres://prod
+    local:
+      match_server_version: false
+`)
+
+	if !cfg.GetLocal(cfg.GetEnvironment("dev")).MatchesServerVersion() {
+		t.Error("dev should follow the global match_server_version")
+	}
+	if cfg.GetLocal(cfg.GetEnvironment("prod")).MatchesServerVersion() {
+		t.Error("prod turns match_server_version off")
+	}
+}
+
+func TestGetLocalSharedContainer(t *testing.T) {
+	cfg := loadConfig(t, `
+environments:
+  - name: dev
+    db_dsn: postgres://dev
+  - name: stage
+    db_dsn: postgres://stage
+    local:
+      image: postgres:15
+`)
+
+	dev := cfg.GetLocal(cfg.GetEnvironment("dev"))
+	stage := cfg.GetLocal(cfg.GetEnvironment("stage"))
+	if dev.ContainerName != "local_postgres" || stage.ContainerName != "local_postgres" {
+		t.Errorf("environments should share the container, got %s and %s", dev.ContainerName, stage.ContainerName)
+	}
+	if dev.Port != 5432 || dev.Password != "pass" || dev.Image != "postgres:16" || dev.Volume != "local_postgres_data" {
+		t.Errorf("defaults not applied: %+v", dev)
+	}
+	if stage.Image != "postgres:15" {
+		t.Errorf("environment override not applied: %+v", stage)
+	}
+	if dev.Target() != stage.Target() {
+		t.Errorf("environments sharing the container need one target, got %s and %s", dev.Target(), stage.Target())
+	}
+}
+
+func TestGetLocalNativePerEnvironment(t *testing.T) {
+	cfg := loadConfig(t, `
+local:
+  mode: native
+  per_environment: true
+  port: 5433
+environments:
+  - name: dev
+    db_dsn: postgres://dev
+  - name: stage
+    db_dsn: postgres://stage
+  - name: prod
+    db_dsn: postgres://prod
+    local:
+      port: 6000
+`)
+
+	tests := map[string]int{"dev": 5433, "stage": 5433, "prod": 6000}
+	for name, port := range tests {
+		if local := cfg.GetLocal(cfg.GetEnvironment(name)); local.Port != port {
+			t.Errorf("%s: got port %d, want %d", name, local.Port, port)
+		}
+	}
+	if dev, stage := cfg.GetLocal(cfg.GetEnvironment("dev")), cfg.GetLocal(cfg.GetEnvironment("stage")); dev.Target() != stage.Target() {
+		t.Errorf("environments sharing the native server need one target, got %s and %s", dev.Target(), stage.Target())
+	}
+}
+
+func TestSetLocalPortIsSaved(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	write := func(port string) *Config {
+		t.Helper()
+		yaml := "local:\n  port: " + port + "\nenvironments:\n  - name: dev\n    db_dsn: postgres://dev\n"
+		if err := os.WriteFile(path, []byte(yaml), 0644); err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := LoadConfig(path, filepath.Join(dir, "dumps"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cfg
+	}
+
+	cfg := write("5432")
+	if err := cfg.SetLocalPort(cfg.GetEnvironment("dev"), 5433); err != nil {
+		t.Fatal(err)
+	}
+
+	// Saved port is used after restart
+	cfg = write("5432")
+	if conn := cfg.LocalConnection(cfg.GetEnvironment("dev")); conn.Port != "5433" {
+		t.Errorf("saved port not used, got %s", conn.Port)
+	}
+
+	// Changing the configured port drops the saved one
+	cfg = write("6000")
+	if local := cfg.GetLocal(cfg.GetEnvironment("dev")); local.Port != 6000 {
+		t.Errorf("configured port not used, got %d", local.Port)
+	}
+
+	cfg = write("5432")
+	if err := cfg.ResetLocalPort(cfg.GetEnvironment("dev")); err != nil {
+		t.Fatal(err)
+	}
+	if local := cfg.GetLocal(cfg.GetEnvironment("dev")); local.Port != 5432 {
+		t.Errorf("port not reset, got %d", local.Port)
+	}
+}
+
+func TestGetRetention(t *testing.T) {
+	cfg := loadConfig(t, `
+retention:
+  keep_last: 5
+  max_age_days: 30
+  max_total_size: 20GB
+environments:
+  - name: dev
+    db_dsn: postgres://dev
+  - name: stage
+    db_dsn: postgres://stage
+    retention:
+      keep_last: 2
+  - name: prod
+    db_dsn: postgres://prod
+    retention:
+      keep_last: 0
+      max_total_size: 0
+`)
+
+	tests := []struct {
+		env          string
+		keepLast     int
+		maxAgeDays   int
+		maxTotalSize env.ByteSize
+	}{
+		{"dev", 5, 30, 20 << 30},
+		{"stage", 2, 30, 20 << 30},
+		{"prod", 0, 30, 0},
+	}
+	for _, tt := range tests {
+		r := cfg.GetRetention(cfg.GetEnvironment(tt.env))
+		if r.KeepLast != tt.keepLast || r.MaxAgeDays != tt.maxAgeDays || r.MaxTotalSize != tt.maxTotalSize {
+			t.Errorf("%s: got %+v, want keep %d, %d days, %d bytes",
+				tt.env, r, tt.keepLast, tt.maxAgeDays, tt.maxTotalSize)
+		}
+	}
+}
+
+func TestGetPipeline(t *testing.T) {
+	cfg := loadConfig(t, `
+pipelines:
+  - name: quick
+    steps: [load, migrate 20240101120000]
+environments:
+  - name: dev
+    db_dsn: postgres://dev
+`)
+
+	refresh, err := cfg.GetPipeline("refresh")
+	if err != nil || len(refresh.Steps) != 4 {
+		t.Fatalf("expected default refresh pipeline, got %+v: %v", refresh, err)
+	}
+
+	quick, err := cfg.GetPipeline("quick")
+	if err != nil {
+		t.Fatal(err)
+	}
+	steps, err := quick.ParseSteps()
+	if err != nil || len(steps) != 2 || steps[1].Action != "migrate" || steps[1].Arg != "20240101120000" {
+		t.Errorf("unexpected steps %+v: %v", steps, err)
+	}
+
+	if _, err := cfg.GetPipeline("missing"); err == nil {
+		t.Error("expected error for unknown pipeline")
+	}
+}
+
+func TestInvalidPipelineStep(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	yaml := `
+pipelines:
+  - name: refresh
+    steps: [dump, migrate newest]
+environments:
+  - name: dev
+    db_dsn: postgres://dev
+`
+	if err := os.WriteFile(path, []byte(yaml), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := LoadConfig(path, filepath.Join(dir, "dumps"))
+	if err == nil || !strings.Contains(err.Error(), `invalid migration version "newest"`) {
+		t.Errorf("expected invalid step error, got %v", err)
+	}
+}
+
+func TestInvalidSubset(t *testing.T) {
+	tests := map[string]string{
+		"dump_format: custom":         "only supported for plain format",
+		"exclude_tables: [audit_*]":   "can't be combined with table filters",
+		"include_tables: [tenants]":   "can't be combined with table filters",
+		"exclude_table_data: [event]": "can't be combined with table filters",
+	}
+	for setting, want := range tests {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "config.yaml")
+		yaml := `
+environments:
+  - name: prod
+    db_dsn: postgres://prod
+    subset: "tenants where id = 42"
+    ` + setting + "\n"
+		if err := os.WriteFile(path, []byte(yaml), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := LoadConfig(path, filepath.Join(dir, "dumps"))
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected %q error, got %v", setting, want, err)
+		}
+	}
+}
+
+func TestExampleConfigLoads(t *testing.T) {
+	if _, err := LoadConfig("../../config.example.yaml", t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,87 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"dumper/config/env"
+)
+
+// PortsFile keeps host ports local containers were published on because the configured
+// port was taken. It lives in the dumps directory next to the dump catalog.
+const PortsFile = "local_ports.json"
+
+// savedPort is the port a container was published on instead of the configured one.
+// It only applies while the configured port stays the same.
+type savedPort struct {
+	Configured int `json:"configured"`
+	Port       int `json:"port"`
+}
+
+// loadPorts reads saved ports, a missing file means none
+func loadPorts(dumpsDir string) (map[string]savedPort, error) {
+	ports := make(map[string]savedPort)
+
+	data, err := os.ReadFile(filepath.Join(dumpsDir, PortsFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return ports, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading saved ports: %w", err)
+	}
+	if err := json.Unmarshal(data, &ports); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", PortsFile, err)
+	}
+	return ports, nil
+}
+
+// SetLocalPort saves the port the environment's container was published on,
+// so that GetLocal and LocalConnection return it from now on
+func (c *Config) SetLocalPort(e *env.Environment, port int) error {
+	local := c.configuredLocal(e)
+
+	c.portsMu.Lock()
+	defer c.portsMu.Unlock()
+	if port == local.Port {
+		delete(c.ports, local.ContainerName)
+	} else {
+		c.ports[local.ContainerName] = savedPort{Configured: local.Port, Port: port}
+	}
+	return c.savePorts()
+}
+
+// ResetLocalPort forgets the saved port of the environment's container,
+// e.g. after the container is removed
+func (c *Config) ResetLocalPort(e *env.Environment) error {
+	local := c.configuredLocal(e)
+
+	c.portsMu.Lock()
+	defer c.portsMu.Unlock()
+	if _, ok := c.ports[local.ContainerName]; !ok {
+		return nil
+	}
+	delete(c.ports, local.ContainerName)
+	return c.savePorts()
+}
+
+// savePorts writes saved ports, replacing the file atomically. Callers hold portsMu.
+func (c *Config) savePorts() error {
+	data, err := json.MarshalIndent(c.ports, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(c.DumpsDir, PortsFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("error saving ports: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("error saving ports: %w", err)
+	}
+	return nil
+}
@@ -1,10 +1,44 @@
 package env
 
+import "fmt"
+
 // Environment represents a database environment configuration
 type Environment struct {
-	Name          string `yaml:"name"`
-	DbDsn         string `yaml:"db_dsn"`
-	MigrationsDir string `yaml:"migrations_dir"`
+	Name          string             `yaml:"name"`
+	DbDsn         string             `yaml:"db_dsn"`
+	MigrationsDir string             `yaml:"migrations_dir"`
+	DumpFormat    string             `yaml:"dump_format"`   // plain (default), custom or directory
+	Compression   string             `yaml:"compression"`   // gzip or zstd, plain format only
+	Jobs          int                `yaml:"jobs"`          // parallel jobs for directory dumps and pg_restore
+	Retention     *RetentionOverride `yaml:"retention"`     // overrides global retention settings
+	Schemas       []string           `yaml:"schemas"`       // schemas to dump, only public by default
+	MaskingRules  string             `yaml:"masking_rules"` // path to masking rules file
+	Subset        string             `yaml:"subset"`        // dump only rows reachable from "<table> where <condition>"
+	Local         *Local             `yaml:"local"`         // overrides global local database settings
+
+	// Table filters, glob patterns as understood by pg_dump (e.g. "audit_*")
+	IncludeTables    []string `yaml:"include_tables"`     // dump only matching tables
+	ExcludeTables    []string `yaml:"exclude_tables"`     // don't dump matching tables
+	ExcludeTableData []string `yaml:"exclude_table_data"` // dump structure but not data of matching tables
+}
+
+// HasTableFilters reports whether any table filters are configured
+func (e *Environment) HasTableFilters() bool {
+	return len(e.IncludeTables) > 0 || len(e.ExcludeTables) > 0 || len(e.ExcludeTableData) > 0
+}
+
+// Validate checks that the settings of the environment can be used together
+func (e *Environment) Validate() error {
+	if e.Subset == "" {
+		return nil
+	}
+	if e.DumpFormat != "" && e.DumpFormat != "plain" {
+		return fmt.Errorf("subset dumps are only supported for plain format, not %s", e.DumpFormat)
+	}
+	if e.HasTableFilters() {
+		return fmt.Errorf("subset dumps can't be combined with table filters")
+	}
+	return nil
 }
 
 // Config represents a list of environments
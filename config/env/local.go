@@ -0,0 +1,139 @@
+package env
+
+import "fmt"
+
+// Local database modes
+const (
+	LocalModeContainer = "container" // PostgreSQL in a container managed by the tool
+	LocalModeNative    = "native"    // already running PostgreSQL, e.g. installed with Homebrew
+)
+
+// Defaults of the local database settings
+const (
+	DefaultContainerName  = "local_postgres"
+	DefaultImage          = "postgres:16"
+	DefaultPassword       = "pass" // password of the container's postgres user
+	DefaultHost           = "localhost"
+	DefaultPort           = 5432
+	DefaultUser           = "postgres"
+	DefaultMaxWaitSeconds = 30 // how long to wait for PostgreSQL to start in container
+)
+
+// Local describes the local database dumps are loaded into
+type Local struct {
+	Mode           string `yaml:"mode"`             // container (default) or native
+	Runtime        string `yaml:"runtime"`          // container runtime: docker, podman or nerdctl, detected if empty
+	ContainerName  string `yaml:"container_name"`   // name of the container
+	Image          string `yaml:"image"`            // PostgreSQL image the container is created from
+	Host           string `yaml:"host"`             // host the local server is reached at
+	Port           int    `yaml:"port"`             // port the local server is reached at
+	User           string `yaml:"user"`             // native server user, the container always uses postgres
+	Password       string `yaml:"password"`         // password of the local server user
+	MaxWaitSeconds int    `yaml:"max_wait_seconds"` // how long to wait for PostgreSQL to start in container
+
+	// PerEnvironment gives every environment its own container, named like local_postgres_dev,
+	// with its own port following the configured one and a named volume for the data.
+	// Nil means not set, so an environment can turn it off with false.
+	PerEnvironment *bool  `yaml:"per_environment"`
+	Volume         string `yaml:"volume"` // named volume for the data directory, <container_name>_data by default
+
+	// MatchServerVersion creates the container from the image tagged with
+	// the major version of the server the dump was made from, e.g. postgres:13.
+	// Nil means not set, so an environment can turn it off with false.
+	MatchServerVersion *bool `yaml:"match_server_version"`
+}
+
+// IsNative reports whether dumps are loaded into an already running server
+func (l Local) IsNative() bool {
+	return l.Mode == LocalModeNative
+}
+
+// IsPerEnvironment reports whether every environment gets its own container
+func (l Local) IsPerEnvironment() bool {
+	return l.PerEnvironment != nil && *l.PerEnvironment
+}
+
+// MatchesServerVersion reports whether the container image follows the source server version
+func (l Local) MatchesServerVersion() bool {
+	return l.MatchServerVersion != nil && *l.MatchServerVersion
+}
+
+// Target identifies the local server, environments sharing it have the same target.
+// A native server is one per host and port, a container one per container name.
+func (l Local) Target() string {
+	if l.IsNative() {
+		return fmt.Sprintf("native %s:%d", l.Host, l.Port)
+	}
+	return "container " + l.ContainerName
+}
+
+// Merge returns settings with non-empty fields of override applied, flags set to false included
+func (l Local) Merge(override *Local) Local {
+	if override == nil {
+		return l
+	}
+	if override.Mode != "" {
+		l.Mode = override.Mode
+	}
+	if override.Runtime != "" {
+		l.Runtime = override.Runtime
+	}
+	if override.ContainerName != "" {
+		l.ContainerName = override.ContainerName
+	}
+	if override.Image != "" {
+		l.Image = override.Image
+	}
+	if override.Host != "" {
+		l.Host = override.Host
+	}
+	if override.Port != 0 {
+		l.Port = override.Port
+	}
+	if override.User != "" {
+		l.User = override.User
+	}
+	if override.Password != "" {
+		l.Password = override.Password
+	}
+	if override.MaxWaitSeconds != 0 {
+		l.MaxWaitSeconds = override.MaxWaitSeconds
+	}
+	if override.PerEnvironment != nil {
+		l.PerEnvironment = override.PerEnvironment
+	}
+	if override.Volume != "" {
+		l.Volume = override.Volume
+	}
+	if override.MatchServerVersion != nil {
+		l.MatchServerVersion = override.MatchServerVersion
+	}
+	return l
+}
+
+// WithDefaults returns settings with defaults filled in for empty fields.
+// Native server has its own credentials, so without a password ~/.pgpass is used.
+func (l Local) WithDefaults() Local {
+	defaults := Local{
+		Mode:           LocalModeContainer,
+		ContainerName:  DefaultContainerName,
+		Image:          DefaultImage,
+		Host:           DefaultHost,
+		Port:           DefaultPort,
+		User:           DefaultUser,
+		Password:       DefaultPassword,
+		MaxWaitSeconds: DefaultMaxWaitSeconds,
+	}
+	if l.IsNative() {
+		defaults.Password = ""
+	} else {
+		l.User = DefaultUser
+	}
+
+	l = defaults.Merge(&l)
+	if !l.IsNative() && l.Volume == "" {
+		// Loaded databases survive removing the container
+		l.Volume = l.ContainerName + "_data"
+	}
+	return l
+}
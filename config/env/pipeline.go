@@ -0,0 +1,92 @@
+package env
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Pipeline steps
+const (
+	StepDump    = "dump"    // create a dump of the environment
+	StepLoad    = "load"    // load the latest dump into the local database
+	StepCopy    = "copy"    // stream the database into the local database without a dump file
+	StepMigrate = "migrate" // migrate the local database, to the latest version by default
+	StepVerify  = "verify"  // check that the local database has tables and no pending migrations
+)
+
+// RefreshPipeline is the name of the pipeline run by the refresh command
+const RefreshPipeline = "refresh"
+
+// Pipeline is a named sequence of steps run on an environment
+type Pipeline struct {
+	Name  string   `yaml:"name"`
+	Steps []string `yaml:"steps"` // e.g. "dump", "load", "copy", "migrate latest", "verify"
+}
+
+// Step is a parsed pipeline step
+type Step struct {
+	Action string
+	Arg    string // target version of migrate, "latest" by default
+}
+
+func (s Step) String() string {
+	if s.Arg != "" {
+		return s.Action + " " + s.Arg
+	}
+	return s.Action
+}
+
+// DefaultRefresh is the refresh pipeline used when none is configured
+var DefaultRefresh = Pipeline{
+	Name:  RefreshPipeline,
+	Steps: []string{StepDump, StepLoad, StepMigrate, StepVerify},
+}
+
+// ParseSteps parses steps of the pipeline
+func (p Pipeline) ParseSteps() ([]Step, error) {
+	if len(p.Steps) == 0 {
+		return nil, fmt.Errorf("pipeline %s has no steps", p.Name)
+	}
+
+	steps := make([]Step, 0, len(p.Steps))
+	for _, s := range p.Steps {
+		step, err := ParseStep(s)
+		if err != nil {
+			return nil, fmt.Errorf("pipeline %s: %w", p.Name, err)
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// ParseStep parses a step like "migrate 20240101120000"
+func ParseStep(value string) (Step, error) {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return Step{}, fmt.Errorf("empty step")
+	}
+
+	step := Step{Action: fields[0]}
+	switch step.Action {
+	case StepDump, StepLoad, StepCopy, StepVerify:
+		if len(fields) > 1 {
+			return Step{}, fmt.Errorf("step %s takes no arguments", step.Action)
+		}
+	case StepMigrate:
+		step.Arg = "latest"
+		if len(fields) > 2 {
+			return Step{}, fmt.Errorf("step %s takes a single version", step.Action)
+		}
+		if len(fields) == 2 {
+			step.Arg = fields[1]
+		}
+		if _, err := strconv.ParseInt(step.Arg, 10, 64); err != nil && step.Arg != "latest" {
+			return Step{}, fmt.Errorf("invalid migration version %q: expected a number or latest", step.Arg)
+		}
+	default:
+		return Step{}, fmt.Errorf("unknown step %q: expected %s, %s, %s, %s or %s",
+			value, StepDump, StepLoad, StepCopy, StepMigrate, StepVerify)
+	}
+	return step, nil
+}
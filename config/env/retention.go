@@ -0,0 +1,93 @@
+package env
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Retention describes which dumps are kept when old dumps are pruned.
+// Zero values mean no limit.
+type Retention struct {
+	KeepLast     int      `yaml:"keep_last"`      // keep at most N dumps
+	MaxAgeDays   int      `yaml:"max_age_days"`   // remove dumps older than N days
+	MaxTotalSize ByteSize `yaml:"max_total_size"` // maximum total size of dumps, e.g. 20GB
+}
+
+// RetentionOverride overrides retention settings of one environment. Omitted fields keep
+// the global value, zero is a value: "keep_last: 0" lifts the global limit.
+type RetentionOverride struct {
+	KeepLast     *int      `yaml:"keep_last"`
+	MaxAgeDays   *int      `yaml:"max_age_days"`
+	MaxTotalSize *ByteSize `yaml:"max_total_size"`
+}
+
+// Merge returns retention with the fields set in override applied
+func (r Retention) Merge(override *RetentionOverride) Retention {
+	if override == nil {
+		return r
+	}
+	if override.KeepLast != nil {
+		r.KeepLast = *override.KeepLast
+	}
+	if override.MaxAgeDays != nil {
+		r.MaxAgeDays = *override.MaxAgeDays
+	}
+	if override.MaxTotalSize != nil {
+		r.MaxTotalSize = *override.MaxTotalSize
+	}
+	return r
+}
+
+// IsZero reports whether no retention limits are set
+func (r Retention) IsZero() bool {
+	return r.KeepLast == 0 && r.MaxAgeDays == 0 && r.MaxTotalSize == 0
+}
+
+// ByteSize is a size in bytes that can be written in config as "500MB" or "20GB"
+type ByteSize int64
+
+var sizeUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"TB", 1 << 40},
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+	{"B", 1},
+}
+
+// ParseByteSize parses size with an optional unit suffix
+func ParseByteSize(value string) (ByteSize, error) {
+	s := strings.ToUpper(strings.TrimSpace(value))
+	multiplier := int64(1)
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(s, u.suffix) {
+			s = strings.TrimSpace(strings.TrimSuffix(s, u.suffix))
+			multiplier = u.size
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size: %q", value)
+	}
+	return ByteSize(n * float64(multiplier)), nil
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler
+func (b *ByteSize) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var value string
+	if err := unmarshal(&value); err != nil {
+		return err
+	}
+
+	size, err := ParseByteSize(value)
+	if err != nil {
+		return err
+	}
+	*b = size
+	return nil
+}
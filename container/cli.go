@@ -0,0 +1,217 @@
+package container
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// stopTimeout is how long an interrupted tool has to exit before it is killed
+const stopTimeout = 5 * time.Second
+
+// CLI is a driver running a Docker compatible command line tool, such as podman or nerdctl
+type CLI struct {
+	binary string
+}
+
+// NewCLI creates a driver for the command line tool found in PATH
+func NewCLI(binary string) (*CLI, error) {
+	path, err := exec.LookPath(binary)
+	if err != nil {
+		return nil, fmt.Errorf("%s not found: %w", binary, err)
+	}
+	return &CLI{binary: path}, nil
+}
+
+// command runs the tool with the arguments. Env values are passed through the process
+// environment, so that arguments like "-e NAME" never hold secrets.
+// Cancelling ctx interrupts the tool, which passes the signal on to the container.
+func (c *CLI) command(ctx context.Context, env []string, stdin io.Reader, stdout io.Writer, stderr io.Writer, args ...string) error {
+	var captured bytes.Buffer
+	cmd := exec.CommandContext(ctx, c.binary, args...)
+	cmd.Cancel = func() error { return cmd.Process.Signal(os.Interrupt) }
+	cmd.WaitDelay = stopTimeout
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = &captured
+	if stderr != nil {
+		cmd.Stderr = io.MultiWriter(&captured, stderr)
+	}
+
+	err := cmd.Run()
+	if err == nil {
+		return nil
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return err
+	}
+	if stderr != nil {
+		// Output is already shown to the caller, only the exit code is left to report
+		return &ExitError{Code: exitErr.ExitCode()}
+	}
+	return classifyError(strings.TrimSpace(captured.String()), exitErr.ExitCode())
+}
+
+// output runs the tool and returns its stdout
+func (c *CLI) output(args ...string) (string, error) {
+	var stdout bytes.Buffer
+	err := c.command(context.Background(), nil, nil, &stdout, nil, args...)
+	return strings.TrimSpace(stdout.String()), err
+}
+
+// classifyError maps error messages of docker, podman and nerdctl to the driver errors
+func classifyError(message string, code int) error {
+	lower := strings.ToLower(message)
+	switch {
+	case strings.Contains(lower, "no such container"):
+		return fmt.Errorf("%w: %s", ErrNotFound, message)
+	case strings.Contains(lower, "port is already allocated"), strings.Contains(lower, "address already in use"):
+		return fmt.Errorf("%w: %s", ErrPortInUse, message)
+	case strings.Contains(lower, "is already in use"), strings.Contains(lower, "is already used"):
+		return fmt.Errorf("%w: %s", ErrNameConflict, message)
+	case message == "":
+		return &ExitError{Code: code}
+	default:
+		return fmt.Errorf("%w: %s", &ExitError{Code: code}, message)
+	}
+}
+
+// Inspect implements Driver
+func (c *CLI) Inspect(name string) (State, error) {
+	output, err := c.output("container", "inspect", "--format", "{{.State.Running}} {{.State.Status}} {{.Config.Image}}", name)
+	if errors.Is(err, ErrNotFound) {
+		return State{}, nil
+	}
+	if err != nil {
+		return State{}, fmt.Errorf("error inspecting container %s: %w", name, err)
+	}
+
+	fields := strings.Fields(output)
+	for len(fields) < 3 {
+		fields = append(fields, "")
+	}
+	return State{Exists: true, Running: fields[0] == "true", Status: fields[1], Image: fields[2]}, nil
+}
+
+// Pull implements Driver
+func (c *CLI) Pull(image string) error {
+	if err := c.command(context.Background(), nil, nil, nil, nil, "pull", image); err != nil {
+		return fmt.Errorf("error pulling image %s: %w", image, err)
+	}
+	return nil
+}
+
+// Run implements Driver
+func (c *CLI) Run(spec Spec) error {
+	// Tools pull missing images on run, check first so that the caller decides
+	if _, err := c.output("image", "inspect", spec.Image); err != nil {
+		return fmt.Errorf("%w: %s", ErrImageNotFound, spec.Image)
+	}
+
+	args := []string{"run", "-d", "--name", spec.Name}
+	args = append(args, envArgs(spec.Env)...)
+	for containerPort, hostPort := range spec.Ports {
+		args = append(args, "-p", fmt.Sprintf("%d:%d", hostPort, containerPort))
+	}
+	for volume, path := range spec.Volumes {
+		args = append(args, "-v", volume+":"+path)
+	}
+	args = append(args, spec.Image)
+
+	if err := c.command(context.Background(), spec.Env, nil, nil, nil, args...); err != nil {
+		if errors.Is(err, ErrPortInUse) {
+			// The container is created even if the port can't be published
+			c.Remove(spec.Name)
+			return err
+		}
+		if errors.Is(err, ErrNameConflict) {
+			return err
+		}
+		return fmt.Errorf("error creating container %s: %w", spec.Name, err)
+	}
+	return nil
+}
+
+// Start implements Driver
+func (c *CLI) Start(name string) error {
+	err := c.command(context.Background(), nil, nil, nil, nil, "start", name)
+	if err != nil && !errors.Is(err, ErrNotFound) && !errors.Is(err, ErrPortInUse) {
+		return fmt.Errorf("error starting container %s: %w", name, err)
+	}
+	return err
+}
+
+// Stop implements Driver
+func (c *CLI) Stop(name string) error {
+	err := c.command(context.Background(), nil, nil, nil, nil, "stop", name)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("error stopping container %s: %w", name, err)
+	}
+	return err
+}
+
+// Remove implements Driver
+func (c *CLI) Remove(name string) error {
+	err := c.command(context.Background(), nil, nil, nil, nil, "rm", "-f", name)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("error removing container %s: %w", name, err)
+	}
+	return err
+}
+
+// RemoveVolume implements Driver
+func (c *CLI) RemoveVolume(name string) error {
+	err := c.command(context.Background(), nil, nil, nil, nil, "volume", "rm", name)
+	if err != nil && strings.Contains(strings.ToLower(err.Error()), "no such volume") {
+		return fmt.Errorf("%w: volume %s", ErrNotFound, name)
+	}
+	if err != nil {
+		return fmt.Errorf("error removing volume %s: %w", name, err)
+	}
+	return nil
+}
+
+// Exec implements Driver
+func (c *CLI) Exec(ctx context.Context, name string, e Exec) error {
+	args := []string{"exec"}
+	if e.Stdin != nil {
+		args = append(args, "-i")
+	}
+	args = append(args, envArgs(e.Env)...)
+	args = append(args, name)
+	args = append(args, e.Cmd...)
+
+	return c.command(ctx, e.Env, e.Stdin, e.Stdout, e.Stderr, args...)
+}
+
+// CopyTo implements Driver
+func (c *CLI) CopyTo(name string, src string, dst string) error {
+	if err := c.command(context.Background(), nil, nil, nil, nil, "cp", src, name+":"+dst); err != nil {
+		return fmt.Errorf("error copying %s into container %s: %w", src, name, err)
+	}
+	return nil
+}
+
+// envArgs returns "-e NAME" arguments for NAME=value pairs, values are taken from the environment
+func envArgs(env []string) []string {
+	args := make([]string, 0, 2*len(env))
+	for _, e := range env {
+		name, _, _ := strings.Cut(e, "=")
+		args = append(args, "-e", name)
+	}
+	return args
+}
@@ -0,0 +1,88 @@
+package container
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := map[string]error{
+		"Error: No such container: local_postgres":                                                   ErrNotFound,
+		"Error: no container with name or ID \"local_postgres\" found: no such container":            ErrNotFound,
+		"Bind for 0.0.0.0:5432 failed: port is already allocated":                                    ErrPortInUse,
+		"rootlessport listen tcp 0.0.0.0:5432: bind: address already in use":                         ErrPortInUse,
+		"Error: creating container storage: the container name \"local_postgres\" is already in use": ErrNameConflict,
+		"FATA[0000] name \"local_postgres\" is already used by ID 6f3a":                              ErrNameConflict,
+	}
+	for message, want := range tests {
+		if err := classifyError(message, 125); !errors.Is(err, want) {
+			t.Errorf("classifyError(%q) = %v, want %v", message, err, want)
+		}
+	}
+
+	var exitErr *ExitError
+	if err := classifyError("psql: error", 2); !errors.As(err, &exitErr) || exitErr.Code != 2 {
+		t.Errorf("expected exit status 2, got %v", err)
+	}
+}
+
+// fakeTool writes a script logging its arguments and environment, standing in for podman
+func fakeTool(t *testing.T, script string) (*CLI, string) {
+	t.Helper()
+	dir := t.TempDir()
+	log := filepath.Join(dir, "calls.log")
+	path := filepath.Join(dir, "podman")
+	content := "#!/bin/sh\necho \"$@ PASSWORD=$POSTGRES_PASSWORD\" >> " + log + "\n" + script
+	if err := os.WriteFile(path, []byte(content), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return &CLI{binary: path}, log
+}
+
+func TestCLIRunPassesSecretsThroughEnvironment(t *testing.T) {
+	cli, log := fakeTool(t, "")
+
+	err := cli.Run(Spec{
+		Name:  "local_postgres",
+		Image: "postgres:16",
+		Env:   []string{"POSTGRES_PASSWORD=s3cret"},
+		Ports: map[int]int{5432: 5433},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	want := "run -d --name local_postgres -e POSTGRES_PASSWORD -p 5433:5432 postgres:16 PASSWORD=s3cret"
+	if len(lines) != 2 || lines[1] != want {
+		t.Errorf("unexpected calls:\n%s\nwant run call:\n%s", data, want)
+	}
+}
+
+func TestCLIRunReportsMissingImage(t *testing.T) {
+	cli, _ := fakeTool(t, "[ \"$1\" = image ] && echo 'Error: postgres:16: image not known' >&2 && exit 125\nexit 0\n")
+
+	err := cli.Run(Spec{Name: "local_postgres", Image: "postgres:16"})
+	if !errors.Is(err, ErrImageNotFound) {
+		t.Errorf("expected missing image, got %v", err)
+	}
+}
+
+func TestCLIInspectMissingContainer(t *testing.T) {
+	cli, _ := fakeTool(t, "echo 'Error: no such container local_postgres' >&2\nexit 125\n")
+
+	state, err := cli.Inspect("local_postgres")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Exists {
+		t.Error("missing container reported as existing")
+	}
+}
@@ -0,0 +1,288 @@
+// Package containertest provides a fake container driver for tests.
+package containertest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"dumper/container"
+)
+
+// Response is the scripted result of a driver call
+type Response struct {
+	Stdout string
+	Stderr string
+	Err    error
+	Do     func() // called when the call is made, e.g. to cancel the operation
+}
+
+// Call is a driver call recorded by Fake
+type Call struct {
+	Line  string   // call as a command line, like "exec local_postgres createdb dev"
+	Env   []string // environment of run and exec calls
+	Input string   // everything an exec call read from stdin
+}
+
+type rule struct {
+	pattern  string
+	response Response
+}
+
+// Fake is a container.Driver keeping containers in memory.
+// Calls succeed unless a response is scripted with On.
+type Fake struct {
+	mu         sync.Mutex
+	rules      []rule
+	calls      []Call
+	containers map[string]*container.State
+	images     map[string]bool
+	volumes    map[string]bool
+}
+
+// NewFake creates a driver without containers, where all images are present
+func NewFake() *Fake {
+	return &Fake{
+		containers: make(map[string]*container.State),
+		volumes:    make(map[string]bool),
+	}
+}
+
+// On scripts the response for calls whose line contains pattern.
+// When several patterns match, the one added last wins.
+func (f *Fake) On(pattern string, response Response) *Fake {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.rules = append(f.rules, rule{pattern: pattern, response: response})
+	return f
+}
+
+// SetState sets the state of a container, state without Exists removes it
+func (f *Fake) SetState(name string, state container.State) *Fake {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !state.Exists {
+		delete(f.containers, name)
+		return f
+	}
+	f.containers[name] = &state
+	return f
+}
+
+// SetImages makes only the given images present, others have to be pulled
+func (f *Fake) SetImages(images ...string) *Fake {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.images = make(map[string]bool)
+	for _, image := range images {
+		f.images[image] = true
+	}
+	return f
+}
+
+// record records the call and returns its scripted response
+func (f *Fake) record(call Call) Response {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls = append(f.calls, call)
+	for i := len(f.rules) - 1; i >= 0; i-- {
+		if strings.Contains(call.Line, f.rules[i].pattern) {
+			return f.rules[i].response
+		}
+	}
+	return Response{}
+}
+
+// Inspect implements container.Driver
+func (f *Fake) Inspect(name string) (container.State, error) {
+	if resp := f.record(Call{Line: "inspect " + name}); resp.Err != nil {
+		return container.State{}, resp.Err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if state, ok := f.containers[name]; ok {
+		return *state, nil
+	}
+	return container.State{}, nil
+}
+
+// Pull implements container.Driver
+func (f *Fake) Pull(image string) error {
+	if resp := f.record(Call{Line: "pull " + image}); resp.Err != nil {
+		return resp.Err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.images != nil {
+		f.images[image] = true
+	}
+	return nil
+}
+
+// Run implements container.Driver
+func (f *Fake) Run(spec container.Spec) error {
+	line := fmt.Sprintf("run %s %s", spec.Name, spec.Image)
+	for containerPort, hostPort := range spec.Ports {
+		line += fmt.Sprintf(" %d:%d", hostPort, containerPort)
+	}
+	for volume, path := range spec.Volumes {
+		line += fmt.Sprintf(" %s:%s", volume, path)
+	}
+	if resp := f.record(Call{Line: line, Env: spec.Env}); resp.Err != nil {
+		return resp.Err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.images != nil && !f.images[spec.Image] {
+		return fmt.Errorf("%w: %s", container.ErrImageNotFound, spec.Image)
+	}
+	if _, ok := f.containers[spec.Name]; ok {
+		return fmt.Errorf("%w: %s", container.ErrNameConflict, spec.Name)
+	}
+	f.containers[spec.Name] = &container.State{Exists: true, Running: true, Status: "running", Image: spec.Image}
+	for volume := range spec.Volumes {
+		f.volumes[volume] = true
+	}
+	return nil
+}
+
+// Start implements container.Driver
+func (f *Fake) Start(name string) error {
+	if resp := f.record(Call{Line: "start " + name}); resp.Err != nil {
+		return resp.Err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	state, ok := f.containers[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", container.ErrNotFound, name)
+	}
+	state.Running = true
+	state.Status = "running"
+	return nil
+}
+
+// Stop implements container.Driver
+func (f *Fake) Stop(name string) error {
+	if resp := f.record(Call{Line: "stop " + name}); resp.Err != nil {
+		return resp.Err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	state, ok := f.containers[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", container.ErrNotFound, name)
+	}
+	state.Running = false
+	state.Status = "exited"
+	return nil
+}
+
+// Remove implements container.Driver
+func (f *Fake) Remove(name string) error {
+	if resp := f.record(Call{Line: "remove " + name}); resp.Err != nil {
+		return resp.Err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.containers[name]; !ok {
+		return fmt.Errorf("%w: %s", container.ErrNotFound, name)
+	}
+	delete(f.containers, name)
+	return nil
+}
+
+// RemoveVolume implements container.Driver
+func (f *Fake) RemoveVolume(name string) error {
+	if resp := f.record(Call{Line: "remove-volume " + name}); resp.Err != nil {
+		return resp.Err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.volumes[name] {
+		return fmt.Errorf("%w: volume %s", container.ErrNotFound, name)
+	}
+	delete(f.volumes, name)
+	return nil
+}
+
+// HasVolume reports whether the volume exists
+func (f *Fake) HasVolume(name string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.volumes[name]
+}
+
+// Exec implements container.Driver
+func (f *Fake) Exec(ctx context.Context, name string, e container.Exec) error {
+	call := Call{Line: "exec " + name + " " + strings.Join(e.Cmd, " "), Env: e.Env}
+	if e.Stdin != nil {
+		data, err := io.ReadAll(e.Stdin)
+		if err != nil {
+			return err
+		}
+		call.Input = string(data)
+	}
+
+	resp := f.record(call)
+	if resp.Do != nil {
+		resp.Do()
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if e.Stdout != nil {
+		fmt.Fprint(e.Stdout, resp.Stdout)
+	}
+	if e.Stderr != nil {
+		fmt.Fprint(e.Stderr, resp.Stderr)
+	}
+	return resp.Err
+}
+
+// CopyTo implements container.Driver
+func (f *Fake) CopyTo(name string, src string, dst string) error {
+	return f.record(Call{Line: fmt.Sprintf("copy %s %s:%s", src, name, dst)}).Err
+}
+
+// Calls returns all recorded calls in order
+func (f *Fake) Calls() []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]Call(nil), f.calls...)
+}
+
+// Find returns the first recorded call whose line contains pattern
+func (f *Fake) Find(pattern string) (Call, bool) {
+	for _, call := range f.Calls() {
+		if strings.Contains(call.Line, pattern) {
+			return call, true
+		}
+	}
+	return Call{}, false
+}
+
+// Lines returns lines of all recorded calls
+func (f *Fake) Lines() []string {
+	calls := f.Calls()
+	lines := make([]string, len(calls))
+	for i, call := range calls {
+		lines[i] = call.Line
+	}
+	return lines
+}
@@ -0,0 +1,525 @@
+package container
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// defaultDockerHost is the Docker socket used when DOCKER_HOST is not set
+const defaultDockerHost = "unix:///var/run/docker.sock"
+
+// Docker is a driver talking to the Docker Engine API
+type Docker struct {
+	network string
+	address string
+	client  *http.Client
+}
+
+// NewDocker creates a Docker driver for the socket in DOCKER_HOST or the default socket
+func NewDocker() (*Docker, error) {
+	host := os.Getenv("DOCKER_HOST")
+	if host == "" {
+		host = defaultDockerHost
+	}
+	return NewDockerHost(host)
+}
+
+// NewDockerHost creates a Docker driver for host like unix:///var/run/docker.sock or tcp://127.0.0.1:2375
+func NewDockerHost(host string) (*Docker, error) {
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Docker host %q: %w", host, err)
+	}
+
+	d := &Docker{network: u.Scheme}
+	switch u.Scheme {
+	case "unix":
+		d.address = u.Path
+	case "tcp":
+		d.address = u.Host
+	default:
+		return nil, fmt.Errorf("unsupported Docker host %q: only unix and tcp are supported", host)
+	}
+
+	d.client = &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return d.dial(ctx)
+			},
+		},
+	}
+	return d, nil
+}
+
+func (d *Docker) dial(ctx context.Context) (net.Conn, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, d.network, d.address)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to Docker at %s: %w", d.address, err)
+	}
+	return conn, nil
+}
+
+// apiError is an error response of the Docker API
+type apiError struct {
+	status  int
+	message string
+}
+
+func (e *apiError) Error() string {
+	return e.message
+}
+
+// request sends an API request. Body is encoded as JSON unless it is a reader.
+// Responses with error status are returned as *apiError.
+func (d *Docker) request(method string, endpoint string, query url.Values, body interface{}) (*http.Response, error) {
+	req, err := d.newRequest(method, endpoint, query, body)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		return nil, readError(resp)
+	}
+	return resp, nil
+}
+
+func (d *Docker) newRequest(method string, endpoint string, query url.Values, body interface{}) (*http.Request, error) {
+	var reader io.Reader
+	contentType := "application/json"
+	switch b := body.(type) {
+	case nil:
+	case io.Reader:
+		reader = b
+		contentType = "application/x-tar"
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	u := url.URL{Scheme: "http", Host: "docker", Path: endpoint, RawQuery: query.Encode()}
+	req, err := http.NewRequest(method, u.String(), reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	return req, nil
+}
+
+// call sends an API request and decodes the JSON response into result, if it is not nil
+func (d *Docker) call(method string, endpoint string, query url.Values, body interface{}, result interface{}) error {
+	resp, err := d.request(method, endpoint, query, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if result == nil {
+		_, err = io.Copy(io.Discard, resp.Body)
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+func readError(resp *http.Response) error {
+	data, _ := io.ReadAll(resp.Body)
+	var body struct {
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(data, &body); err != nil || body.Message == "" {
+		body.Message = strings.TrimSpace(string(data))
+	}
+	if body.Message == "" {
+		body.Message = resp.Status
+	}
+	return &apiError{status: resp.StatusCode, message: body.Message}
+}
+
+// isStatus reports whether err is an API error with the status
+func isStatus(err error, status int) bool {
+	e, ok := err.(*apiError)
+	return ok && e.status == status
+}
+
+// Inspect implements Driver
+func (d *Docker) Inspect(name string) (State, error) {
+	var info struct {
+		State struct {
+			Running bool   `json:"Running"`
+			Status  string `json:"Status"`
+		} `json:"State"`
+		Config struct {
+			Image string `json:"Image"`
+		} `json:"Config"`
+	}
+	err := d.call(http.MethodGet, "/containers/"+url.PathEscape(name)+"/json", nil, nil, &info)
+	if isStatus(err, http.StatusNotFound) {
+		return State{}, nil
+	}
+	if err != nil {
+		return State{}, fmt.Errorf("error inspecting container %s: %w", name, err)
+	}
+	return State{Exists: true, Running: info.State.Running, Status: info.State.Status, Image: info.Config.Image}, nil
+}
+
+// Pull implements Driver
+func (d *Docker) Pull(image string) error {
+	repository, tag := splitImage(image)
+	query := url.Values{"fromImage": {repository}, "tag": {tag}}
+
+	resp, err := d.request(http.MethodPost, "/images/create", query, nil)
+	if err != nil {
+		return fmt.Errorf("error pulling image %s: %w", image, err)
+	}
+	defer resp.Body.Close()
+
+	// Progress is streamed as JSON messages, failures are reported in them too
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var message struct {
+			Error string `json:"error"`
+		}
+		if err := decoder.Decode(&message); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("error pulling image %s: %w", image, err)
+		}
+		if message.Error != "" {
+			return fmt.Errorf("error pulling image %s: %s", image, message.Error)
+		}
+	}
+}
+
+// splitImage splits image reference into repository and tag, latest by default
+func splitImage(image string) (string, string) {
+	i := strings.LastIndex(image, ":")
+	if i < 0 || strings.Contains(image[i:], "/") {
+		return image, "latest"
+	}
+	return image[:i], image[i+1:]
+}
+
+type portBinding struct {
+	HostPort string `json:"HostPort"`
+}
+
+// Run implements Driver
+func (d *Docker) Run(spec Spec) error {
+	exposed := make(map[string]struct{})
+	bindings := make(map[string][]portBinding)
+	for containerPort, hostPort := range spec.Ports {
+		port := strconv.Itoa(containerPort) + "/tcp"
+		exposed[port] = struct{}{}
+		bindings[port] = []portBinding{{HostPort: strconv.Itoa(hostPort)}}
+	}
+
+	binds := make([]string, 0, len(spec.Volumes))
+	for volume, path := range spec.Volumes {
+		binds = append(binds, volume+":"+path)
+	}
+
+	body := map[string]interface{}{
+		"Image":        spec.Image,
+		"Env":          spec.Env,
+		"ExposedPorts": exposed,
+		"HostConfig": map[string]interface{}{
+			"PortBindings": bindings,
+			"Binds":        binds,
+		},
+	}
+
+	err := d.call(http.MethodPost, "/containers/create", url.Values{"name": {spec.Name}}, body, nil)
+	switch {
+	case isStatus(err, http.StatusNotFound):
+		return fmt.Errorf("%w: %s", ErrImageNotFound, spec.Image)
+	case isStatus(err, http.StatusConflict):
+		return fmt.Errorf("%w: %s", ErrNameConflict, spec.Name)
+	case err != nil:
+		return fmt.Errorf("error creating container %s: %w", spec.Name, err)
+	}
+
+	if err := d.Start(spec.Name); err != nil {
+		// Remove the container so the next attempt is not blocked by its name
+		d.Remove(spec.Name)
+		return err
+	}
+	return nil
+}
+
+// Start implements Driver
+func (d *Docker) Start(name string) error {
+	err := d.call(http.MethodPost, "/containers/"+url.PathEscape(name)+"/start", nil, nil, nil)
+	switch {
+	case isStatus(err, http.StatusNotFound):
+		return fmt.Errorf("%w: %s", ErrNotFound, name)
+	case err != nil && isPortError(err.Error()):
+		return fmt.Errorf("%w: %s", ErrPortInUse, err)
+	case err != nil:
+		return fmt.Errorf("error starting container %s: %w", name, err)
+	}
+	return nil
+}
+
+// Stop implements Driver
+func (d *Docker) Stop(name string) error {
+	err := d.call(http.MethodPost, "/containers/"+url.PathEscape(name)+"/stop", nil, nil, nil)
+	if isStatus(err, http.StatusNotFound) {
+		return fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	if err != nil {
+		return fmt.Errorf("error stopping container %s: %w", name, err)
+	}
+	return nil
+}
+
+// Remove implements Driver
+func (d *Docker) Remove(name string) error {
+	err := d.call(http.MethodDelete, "/containers/"+url.PathEscape(name), url.Values{"force": {"true"}}, nil, nil)
+	if isStatus(err, http.StatusNotFound) {
+		return fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	if err != nil {
+		return fmt.Errorf("error removing container %s: %w", name, err)
+	}
+	return nil
+}
+
+// RemoveVolume implements Driver
+func (d *Docker) RemoveVolume(name string) error {
+	err := d.call(http.MethodDelete, "/volumes/"+url.PathEscape(name), nil, nil, nil)
+	if isStatus(err, http.StatusNotFound) {
+		return fmt.Errorf("%w: volume %s", ErrNotFound, name)
+	}
+	if err != nil {
+		return fmt.Errorf("error removing volume %s: %w", name, err)
+	}
+	return nil
+}
+
+// isPortError reports whether the Docker error message is about a taken host port
+func isPortError(message string) bool {
+	return strings.Contains(message, "port is already allocated") ||
+		strings.Contains(message, "address already in use")
+}
+
+// Exec implements Driver
+func (d *Docker) Exec(ctx context.Context, name string, e Exec) error {
+	var created struct {
+		ID string `json:"Id"`
+	}
+	err := d.call(http.MethodPost, "/containers/"+url.PathEscape(name)+"/exec", nil, map[string]interface{}{
+		"Cmd":          e.Cmd,
+		"Env":          e.Env,
+		"AttachStdin":  e.Stdin != nil,
+		"AttachStdout": true,
+		"AttachStderr": true,
+	}, &created)
+	if isStatus(err, http.StatusNotFound) {
+		return fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	if err != nil {
+		return fmt.Errorf("error running %s in container %s: %w", e.Cmd[0], name, err)
+	}
+
+	if err := d.attachExec(ctx, created.ID, e); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("error running %s in container %s: %w", e.Cmd[0], name, err)
+	}
+
+	var result struct {
+		ExitCode int `json:"ExitCode"`
+	}
+	if err := d.call(http.MethodGet, "/exec/"+created.ID+"/json", nil, nil, &result); err != nil {
+		return fmt.Errorf("error reading exit code of %s: %w", e.Cmd[0], err)
+	}
+	if result.ExitCode != 0 {
+		return &ExitError{Code: result.ExitCode}
+	}
+	return nil
+}
+
+// attachExec starts the exec instance on a hijacked connection, sending stdin
+// and copying the multiplexed output until the command finishes or ctx is cancelled
+func (d *Docker) attachExec(ctx context.Context, id string, e Exec) error {
+	conn, err := d.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Closing the connection unblocks reads and closes stdin of the command
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	req, err := d.newRequest(http.MethodPost, "/exec/"+id+"/start", nil, map[string]bool{"Detach": false, "Tty": false})
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "tcp")
+	if err := req.Write(conn); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		return readError(resp)
+	}
+
+	stdin := &stdinReader{r: e.Stdin}
+	stdinDone := make(chan struct{})
+	if e.Stdin != nil {
+		go func() {
+			defer close(stdinDone)
+			io.Copy(conn, stdin)
+			if c, ok := conn.(interface{ CloseWrite() error }); ok {
+				c.CloseWrite()
+			}
+		}()
+	} else {
+		close(stdinDone)
+	}
+
+	err = demux(reader, e.Stdout, e.Stderr)
+	conn.Close()
+	<-stdinDone
+	if err != nil {
+		return err
+	}
+	if stdin.err != nil {
+		return fmt.Errorf("error reading input: %w", stdin.err)
+	}
+	return nil
+}
+
+// stdinReader remembers read errors, so they are told apart from errors writing to the connection
+type stdinReader struct {
+	r   io.Reader
+	err error
+}
+
+func (s *stdinReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	if err != nil && err != io.EOF {
+		s.err = err
+	}
+	return n, err
+}
+
+// demux copies the Docker multiplexed stream: every frame has an 8 byte header
+// with stream type in the first byte and big endian payload size in the last four
+func demux(r io.Reader, stdout io.Writer, stderr io.Writer) error {
+	if stdout == nil {
+		stdout = io.Discard
+	}
+	if stderr == nil {
+		stderr = io.Discard
+	}
+
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, header); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		w := stdout
+		if header[0] == 2 {
+			w = stderr
+		}
+		size := int64(binary.BigEndian.Uint32(header[4:]))
+		if _, err := io.CopyN(w, r, size); err != nil {
+			return err
+		}
+	}
+}
+
+// CopyTo implements Driver
+func (d *Docker) CopyTo(name string, src string, dst string) error {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeTar(pw, src, path.Base(dst)))
+	}()
+
+	query := url.Values{"path": {path.Dir(dst)}}
+	err := d.call(http.MethodPut, "/containers/"+url.PathEscape(name)+"/archive", query, io.Reader(pr), nil)
+	pr.Close()
+	if isStatus(err, http.StatusNotFound) {
+		return fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	if err != nil {
+		return fmt.Errorf("error copying %s into container %s: %w", src, name, err)
+	}
+	return nil
+}
+
+// writeTar writes file or directory src as a tar archive, naming its root entry name
+func writeTar(w io.Writer, src string, name string) error {
+	tw := tar.NewWriter(w)
+
+	err := filepath.Walk(src, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, file)
+		if err != nil {
+			return err
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = path.Join(name, filepath.ToSlash(rel))
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
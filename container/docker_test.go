@@ -0,0 +1,184 @@
+package container
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestDocker starts a fake Docker API on a unix socket
+func newTestDocker(t *testing.T, handler http.Handler) *Docker {
+	t.Helper()
+
+	// Socket paths are limited in length, so the temp dir is kept short
+	dir, err := os.MkdirTemp("", "docker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	socket := filepath.Join(dir, "docker.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewUnstartedServer(handler)
+	server.Listener = listener
+	server.Start()
+	t.Cleanup(server.Close)
+
+	d, err := NewDockerHost("unix://" + socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	io.WriteString(w, `{"message":"`+message+`"}`)
+}
+
+func TestRunReturnsStructuredErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		want    error
+	}{
+		{
+			name: "image not found",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				writeError(w, http.StatusNotFound, "No such image: postgres:16")
+			},
+			want: ErrImageNotFound,
+		},
+		{
+			name: "name conflict",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				writeError(w, http.StatusConflict, `Conflict. The container name \"/local_postgres\" is already in use`)
+			},
+			want: ErrNameConflict,
+		},
+		{
+			name: "port in use",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case strings.HasSuffix(r.URL.Path, "/start"):
+					writeError(w, http.StatusInternalServerError,
+						"driver failed programming external connectivity: Bind for 0.0.0.0:5432 failed: port is already allocated")
+				case r.Method == http.MethodDelete:
+					w.WriteHeader(http.StatusNoContent)
+				default:
+					w.WriteHeader(http.StatusCreated)
+					io.WriteString(w, `{"Id":"c0ffee"}`)
+				}
+			},
+			want: ErrPortInUse,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newTestDocker(t, tt.handler)
+
+			err := d.Run(Spec{Name: "local_postgres", Image: "postgres:16", Ports: map[int]int{5432: 5432}})
+			if !errors.Is(err, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestInspectMissingContainer(t *testing.T) {
+	d := newTestDocker(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, "No such container: local_postgres")
+	}))
+
+	state, err := d.Inspect("local_postgres")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Exists {
+		t.Error("missing container reported as existing")
+	}
+}
+
+func TestExecStreamsInputAndOutput(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /containers/local_postgres/exec", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, `{"Id":"e1"}`)
+	})
+	mux.HandleFunc("POST /exec/e1/start", func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+
+		buf.WriteString("HTTP/1.1 101 UPGRADED\r\nConnection: Upgrade\r\nUpgrade: tcp\r\n\r\n")
+		buf.Flush()
+
+		input, _ := io.ReadAll(buf)
+		writeFrame(conn, 1, strings.ToUpper(string(input)))
+		writeFrame(conn, 2, "NOTICE: done")
+	})
+	mux.HandleFunc("GET /exec/e1/json", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"ExitCode":3}`)
+	})
+	d := newTestDocker(t, mux)
+
+	var stdout, stderr strings.Builder
+	err := d.Exec(context.Background(), "local_postgres", Exec{
+		Cmd:    []string{"psql"},
+		Stdin:  strings.NewReader("select 1;"),
+		Stdout: &stdout,
+		Stderr: &stderr,
+	})
+
+	var exitErr *ExitError
+	if !errors.As(err, &exitErr) || exitErr.Code != 3 {
+		t.Errorf("expected exit status 3, got %v", err)
+	}
+	if stdout.String() != "SELECT 1;" {
+		t.Errorf("unexpected stdout %q", stdout.String())
+	}
+	if stderr.String() != "NOTICE: done" {
+		t.Errorf("unexpected stderr %q", stderr.String())
+	}
+}
+
+func writeFrame(w io.Writer, stream byte, payload string) {
+	header := make([]byte, 8)
+	header[0] = stream
+	binary.BigEndian.PutUint32(header[4:], uint32(len(payload)))
+	w.Write(header)
+	io.WriteString(w, payload)
+}
+
+func TestSplitImage(t *testing.T) {
+	tests := map[string][2]string{
+		"postgres:16":                 {"postgres", "16"},
+		"postgres":                    {"postgres", "latest"},
+		"registry:5000/team/postgres": {"registry:5000/team/postgres", "latest"},
+		"registry:5000/postgres:15.4": {"registry:5000/postgres", "15.4"},
+	}
+	for image, want := range tests {
+		repository, tag := splitImage(image)
+		if repository != want[0] || tag != want[1] {
+			t.Errorf("splitImage(%q) = %q, %q, want %q, %q", image, repository, tag, want[0], want[1])
+		}
+	}
+}
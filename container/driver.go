@@ -0,0 +1,92 @@
+// Package container manages the local PostgreSQL container.
+package container
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var (
+	// ErrNotFound is returned when the container does not exist
+	ErrNotFound = errors.New("container not found")
+
+	// ErrImageNotFound is returned when the image is not present locally
+	ErrImageNotFound = errors.New("image not found")
+
+	// ErrPortInUse is returned when a published port is already taken on the host
+	ErrPortInUse = errors.New("port is already in use")
+
+	// ErrNameConflict is returned when another container already has the name
+	ErrNameConflict = errors.New("container name is already in use")
+)
+
+// ExitError is returned when a command run in the container exits with non-zero code
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// Spec describes a container to create
+type Spec struct {
+	Name  string
+	Image string
+	Env   []string
+	Ports map[int]int // container port to host port
+
+	// Volumes mounts named volumes, created if missing, at paths in the container
+	Volumes map[string]string
+}
+
+// State is the state of a container
+type State struct {
+	Exists  bool
+	Running bool
+	Status  string // e.g. running, exited, created
+	Image   string
+}
+
+// Exec describes a command run inside a container
+type Exec struct {
+	Cmd    []string
+	Env    []string
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// Driver controls containers of a container runtime
+type Driver interface {
+	// Inspect returns the state of the container, missing container is not an error
+	Inspect(name string) (State, error)
+
+	// Pull downloads the image
+	Pull(image string) error
+
+	// Run creates and starts a new container
+	Run(spec Spec) error
+
+	// Start starts an existing stopped container
+	Start(name string) error
+
+	// Stop stops the running container
+	Stop(name string) error
+
+	// Remove removes the container, stopping it if needed. Its volumes are kept.
+	Remove(name string) error
+
+	// RemoveVolume removes the named volume
+	RemoveVolume(name string) error
+
+	// Exec runs a command in the running container and waits for it to finish.
+	// Cancelling ctx stops waiting and detaches from the command, which keeps running
+	// in the container until it exits, e.g. when the connection it uses is terminated.
+	Exec(ctx context.Context, name string, e Exec) error
+
+	// CopyTo copies a file or directory from the host to path in the container
+	CopyTo(name string, src string, dst string) error
+}
@@ -0,0 +1,63 @@
+package container
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Container runtimes
+const (
+	RuntimeDocker  = "docker"
+	RuntimePodman  = "podman"
+	RuntimeNerdctl = "nerdctl"
+)
+
+// ValidateRuntime checks the runtime name, empty name means auto-detection
+func ValidateRuntime(runtime string) error {
+	switch runtime {
+	case "", RuntimeDocker, RuntimePodman, RuntimeNerdctl:
+		return nil
+	default:
+		return fmt.Errorf("unknown container runtime %q: expected %s, %s or %s",
+			runtime, RuntimeDocker, RuntimePodman, RuntimeNerdctl)
+	}
+}
+
+// New creates a driver for the runtime, detecting it if the name is empty.
+// Docker is used through the Engine API, podman and nerdctl through their command line tools.
+func New(runtime string) (Driver, error) {
+	if runtime == "" {
+		runtime = Detect()
+		if runtime == "" {
+			return nil, fmt.Errorf("no container runtime found: install docker, podman or nerdctl")
+		}
+	}
+
+	switch runtime {
+	case RuntimeDocker:
+		return NewDocker()
+	case RuntimePodman, RuntimeNerdctl:
+		return NewCLI(runtime)
+	default:
+		return nil, ValidateRuntime(runtime)
+	}
+}
+
+// Detect returns the available runtime: Docker if its socket is reachable,
+// otherwise the first of podman and nerdctl found in PATH, empty if none is found
+func Detect() string {
+	if os.Getenv("DOCKER_HOST") != "" {
+		return RuntimeDocker
+	}
+	if _, err := os.Stat(strings.TrimPrefix(defaultDockerHost, "unix://")); err == nil {
+		return RuntimeDocker
+	}
+	for _, runtime := range []string{RuntimePodman, RuntimeNerdctl} {
+		if _, err := exec.LookPath(runtime); err == nil {
+			return runtime
+		}
+	}
+	return ""
+}
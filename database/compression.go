@@ -0,0 +1,122 @@
+package database
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression is the compression applied to plain format dumps
+type Compression string
+
+const (
+	// CompressionNone writes dumps as is
+	CompressionNone Compression = ""
+	// CompressionGzip compresses dumps with gzip
+	CompressionGzip Compression = "gzip"
+	// CompressionZstd compresses dumps with zstd
+	CompressionZstd Compression = "zstd"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// ParseCompression parses compression name from configuration, empty means none
+func ParseCompression(name string) (Compression, error) {
+	switch Compression(name) {
+	case CompressionNone, "none":
+		return CompressionNone, nil
+	case CompressionGzip, CompressionZstd:
+		return Compression(name), nil
+	}
+	return "", fmt.Errorf("unknown compression: %s", name)
+}
+
+// Extension returns the suffix added to compressed dump files
+func (c Compression) Extension() string {
+	switch c {
+	case CompressionGzip:
+		return ".gz"
+	case CompressionZstd:
+		return ".zst"
+	default:
+		return ""
+	}
+}
+
+// dumpWriter writes to the dump file through an optional compressor
+type dumpWriter struct {
+	io.Writer
+	compressor io.WriteCloser
+	file       *os.File
+}
+
+// createDumpFile creates the dump file, compressing everything written to it
+func createDumpFile(dumpFile string, compression Compression) (*dumpWriter, error) {
+	f, err := os.Create(dumpFile)
+	if err != nil {
+		return nil, fmt.Errorf("error creating dump file: %w", err)
+	}
+
+	w := &dumpWriter{Writer: f, file: f}
+	switch compression {
+	case CompressionGzip:
+		w.compressor = gzip.NewWriter(f)
+	case CompressionZstd:
+		w.compressor, err = zstd.NewWriter(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("error creating zstd writer: %w", err)
+		}
+	}
+	if w.compressor != nil {
+		w.Writer = w.compressor
+	}
+
+	return w, nil
+}
+
+// Close flushes the compressor and closes the file
+func (w *dumpWriter) Close() error {
+	if w.compressor != nil {
+		if err := w.compressor.Close(); err != nil {
+			w.file.Close()
+			return fmt.Errorf("error compressing dump: %w", err)
+		}
+	}
+	return w.file.Close()
+}
+
+// decompressReader detects compression of a plain dump by its header
+// and returns reader of the uncompressed SQL
+func decompressReader(r io.Reader) (io.Reader, func(), error) {
+	buffered := bufio.NewReader(r)
+	header, err := buffered.Peek(len(zstdMagic))
+	if err != nil && err != io.EOF {
+		return nil, nil, err
+	}
+
+	switch {
+	case bytes.HasPrefix(header, gzipMagic):
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading gzip dump: %w", err)
+		}
+		return gz, func() { gz.Close() }, nil
+	case bytes.HasPrefix(header, zstdMagic):
+		zr, err := zstd.NewReader(buffered)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading zstd dump: %w", err)
+		}
+		return zr, zr.Close, nil
+	default:
+		return buffered, func() {}, nil
+	}
+}
@@ -0,0 +1,122 @@
+// Package databasetest provides a fake command executor for testing code built on the database package.
+package databasetest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"dumper/database"
+)
+
+// Response is the scripted result of a command
+type Response struct {
+	Stdout string
+	Stderr string
+	Err    error
+	Do     func() // called when the command runs, e.g. to cancel the operation
+}
+
+// Call is a command recorded by Recorder
+type Call struct {
+	database.Command
+	Input string // everything the command read from stdin
+}
+
+type rule struct {
+	pattern  string
+	response Response
+}
+
+// Recorder is a database.Executor that records commands instead of running them.
+// Commands succeed with empty output unless a response is scripted with On.
+type Recorder struct {
+	mu    sync.Mutex
+	rules []rule
+	calls []Call
+}
+
+// NewRecorder creates a recorder without scripted responses
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+// On scripts the response for commands whose command line contains pattern.
+// When several patterns match, the one added last wins.
+func (r *Recorder) On(pattern string, response Response) *Recorder {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.rules = append(r.rules, rule{pattern: pattern, response: response})
+	return r
+}
+
+// Execute implements database.Executor
+func (r *Recorder) Execute(ctx context.Context, cmd database.Command) error {
+	call := Call{Command: cmd}
+	if cmd.Stdin != nil {
+		data, err := io.ReadAll(cmd.Stdin)
+		if err != nil {
+			return err
+		}
+		call.Input = string(data)
+	}
+
+	r.mu.Lock()
+	r.calls = append(r.calls, call)
+	response := r.response(cmd.String())
+	r.mu.Unlock()
+
+	if response.Do != nil {
+		response.Do()
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if cmd.Stdout != nil {
+		fmt.Fprint(cmd.Stdout, response.Stdout)
+	}
+	if cmd.Stderr != nil {
+		fmt.Fprint(cmd.Stderr, response.Stderr)
+	}
+	return response.Err
+}
+
+func (r *Recorder) response(line string) Response {
+	for i := len(r.rules) - 1; i >= 0; i-- {
+		if strings.Contains(line, r.rules[i].pattern) {
+			return r.rules[i].response
+		}
+	}
+	return Response{}
+}
+
+// Calls returns all recorded commands in order
+func (r *Recorder) Calls() []Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]Call(nil), r.calls...)
+}
+
+// Find returns the first recorded command whose command line contains pattern
+func (r *Recorder) Find(pattern string) (Call, bool) {
+	for _, call := range r.Calls() {
+		if strings.Contains(call.String(), pattern) {
+			return call, true
+		}
+	}
+	return Call{}, false
+}
+
+// CommandLines returns command lines of all recorded commands
+func (r *Recorder) CommandLines() []string {
+	calls := r.Calls()
+	lines := make([]string, len(calls))
+	for i, call := range calls {
+		lines[i] = call.String()
+	}
+	return lines
+}
@@ -0,0 +1,9 @@
+package database
+
+import "context"
+
+// RunnerOutput runs the command through a runner, so that external tests
+// can check the runner with databasetest.Recorder
+func RunnerOutput(ctx context.Context, exec Executor, cmd Command) ([]byte, error) {
+	return newRunner(exec, false, nil).Output(ctx, cmd)
+}
@@ -0,0 +1,78 @@
+package database
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// DumpFormat is the pg_dump output format
+type DumpFormat string
+
+const (
+	// FormatPlain is a plain SQL script restored with psql
+	FormatPlain DumpFormat = "plain"
+	// FormatCustom is a compressed archive restored with pg_restore
+	FormatCustom DumpFormat = "custom"
+	// FormatDirectory is a directory of per-table files restored with pg_restore
+	FormatDirectory DumpFormat = "directory"
+)
+
+// customMagic is the header pg_dump writes at the start of custom format archives
+var customMagic = []byte("PGDMP")
+
+// ParseDumpFormat parses format name from configuration, empty means plain
+func ParseDumpFormat(name string) (DumpFormat, error) {
+	switch DumpFormat(name) {
+	case "", FormatPlain:
+		return FormatPlain, nil
+	case FormatCustom, FormatDirectory:
+		return DumpFormat(name), nil
+	}
+	return "", fmt.Errorf("unknown dump format: %s", name)
+}
+
+// Extension returns the file extension used for dumps of this format
+func (f DumpFormat) Extension() string {
+	switch f {
+	case FormatCustom:
+		return ".dump"
+	case FormatDirectory:
+		return ""
+	default:
+		return ".sql"
+	}
+}
+
+// DetectFormat determines format of an existing dump by its contents
+func DetectFormat(dumpFile string) (DumpFormat, error) {
+	info, err := os.Stat(dumpFile)
+	if err != nil {
+		return "", err
+	}
+
+	if info.IsDir() {
+		if _, err := os.Stat(filepath.Join(dumpFile, "toc.dat")); err != nil {
+			return "", fmt.Errorf("directory %s is not a pg_dump directory archive", dumpFile)
+		}
+		return FormatDirectory, nil
+	}
+
+	f, err := os.Open(dumpFile)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	header := make([]byte, len(customMagic))
+	if _, err := io.ReadFull(f, header); err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+
+	if bytes.Equal(header, customMagic) {
+		return FormatCustom, nil
+	}
+	return FormatPlain, nil
+}
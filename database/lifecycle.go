@@ -0,0 +1,190 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"dumper/container"
+)
+
+// ContainerAction is a lifecycle action on the local PostgreSQL container
+type ContainerAction string
+
+// Container actions
+const (
+	ContainerStart    ContainerAction = "start"
+	ContainerStop     ContainerAction = "stop"
+	ContainerRestart  ContainerAction = "restart"
+	ContainerRecreate ContainerAction = "recreate" // remove the container and create it again, keeping the volume
+	ContainerDestroy  ContainerAction = "destroy"  // remove the container and its volume with all loaded databases
+)
+
+// ContainerActions lists all container actions
+var ContainerActions = []ContainerAction{ContainerStart, ContainerStop, ContainerRestart, ContainerRecreate, ContainerDestroy}
+
+// ParseContainerAction returns the container action with the given name
+func ParseContainerAction(s string) (ContainerAction, error) {
+	for _, action := range ContainerActions {
+		if string(action) == s {
+			return action, nil
+		}
+	}
+	return "", fmt.Errorf("unknown container action: %s", s)
+}
+
+// DatabaseSize is the size of a database on the local server
+type DatabaseSize struct {
+	Name string
+	Size int64 // bytes
+}
+
+// ContainerStatus describes the local PostgreSQL container
+type ContainerStatus struct {
+	Name      string
+	Image     string // image the container was created from, configured image if it doesn't exist
+	State     string // running, exited and so on, "missing" if the container doesn't exist
+	Running   bool
+	Port      int
+	Volume    string
+	DiskUsage int64          // bytes used by the data directory, only known while running
+	Databases []DatabaseSize // only known while running
+}
+
+// StateMissing is the state of a container that doesn't exist
+const StateMissing = "missing"
+
+// ManageContainer runs a lifecycle action on the local PostgreSQL container
+func ManageContainer(cfg PostgresConfig, action ContainerAction) error {
+	c, err := newContainer(cfg)
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case ContainerStart:
+		return c.start(context.Background(), "postgres")
+	case ContainerStop:
+		if err := c.driver.Stop(cfg.ContainerName); err != nil {
+			if errors.Is(err, container.ErrNotFound) {
+				return fmt.Errorf("container %s does not exist", cfg.ContainerName)
+			}
+			return err
+		}
+		return nil
+	case ContainerRestart:
+		if err := c.driver.Stop(cfg.ContainerName); err != nil && !errors.Is(err, container.ErrNotFound) {
+			return err
+		}
+		return c.start(context.Background(), "postgres")
+	case ContainerRecreate:
+		if err := removeContainer(c); err != nil {
+			return err
+		}
+		return c.start(context.Background(), "postgres")
+	case ContainerDestroy:
+		if err := removeContainer(c); err != nil {
+			return err
+		}
+		if cfg.Volume == "" {
+			return nil
+		}
+		if err := c.driver.RemoveVolume(cfg.Volume); err != nil && !errors.Is(err, container.ErrNotFound) {
+			return err
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown container action: %s", action)
+	}
+}
+
+// GetContainerStatus returns status and disk usage of the local PostgreSQL container
+func GetContainerStatus(cfg PostgresConfig) (ContainerStatus, error) {
+	c, err := newContainer(cfg)
+	if err != nil {
+		return ContainerStatus{}, err
+	}
+
+	status := ContainerStatus{
+		Name:      cfg.ContainerName,
+		Image:     cfg.Image,
+		State:     StateMissing,
+		Port:      cfg.Port,
+		Volume:    cfg.Volume,
+		DiskUsage: -1,
+	}
+	if status.Port == 0 {
+		status.Port = 5432
+	}
+
+	state, err := c.driver.Inspect(cfg.ContainerName)
+	if err != nil {
+		return status, err
+	}
+	if !state.Exists {
+		return status, nil
+	}
+	status.State = state.Status
+	status.Running = state.Running
+	if state.Image != "" {
+		status.Image = state.Image
+	}
+	if !state.Running {
+		return status, nil
+	}
+
+	// Sizes are informational, the status is shown even if they can't be read
+	if output, err := c.output(context.Background(), "du", "-sk", dataDir); err == nil {
+		kb, _, _ := strings.Cut(strings.TrimSpace(string(output)), "\t")
+		if n, err := strconv.ParseInt(kb, 10, 64); err == nil {
+			status.DiskUsage = n * 1024
+		}
+	}
+	status.Databases, _ = databaseSizes(c)
+	return status, nil
+}
+
+// newContainer returns the local container, container actions make no sense for a native server
+func newContainer(cfg PostgresConfig) (*localContainer, error) {
+	if cfg.NativeDSN != "" {
+		return nil, errors.New("local database runs in native mode, there is no container to manage")
+	}
+	server, err := newLocalServer(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return server.(*localContainer), nil
+}
+
+// removeContainer removes the container if it exists, its volume is kept
+func removeContainer(c *localContainer) error {
+	if err := c.driver.Remove(c.cfg.ContainerName); err != nil && !errors.Is(err, container.ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+// databaseSizes returns sizes of databases on the local server
+func databaseSizes(c *localContainer) ([]DatabaseSize, error) {
+	output, err := c.output(context.Background(), "psql", "-X", "-t", "-A", "-F", "|", "-d", "postgres", "-c",
+		"SELECT datname, pg_database_size(datname) FROM pg_database WHERE NOT datistemplate ORDER BY datname")
+	if err != nil {
+		return nil, err
+	}
+
+	var sizes []DatabaseSize
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		i := strings.LastIndex(line, "|")
+		if i < 0 {
+			continue
+		}
+		size, err := strconv.ParseInt(line[i+1:], 10, 64)
+		if err != nil {
+			continue
+		}
+		sizes = append(sizes, DatabaseSize{Name: line[:i], Size: size})
+	}
+	return sizes, nil
+}
@@ -0,0 +1,102 @@
+package database_test
+
+import (
+	"testing"
+
+	"dumper/container"
+	"dumper/container/containertest"
+	"dumper/database"
+	"dumper/database/databasetest"
+)
+
+// volumeConfig returns settings of a container created with a data volume
+func volumeConfig(t *testing.T, driver *containertest.Fake) database.PostgresConfig {
+	t.Helper()
+	cfg := localConfig(driver)
+	cfg.Volume = "local_postgres_data"
+	if err := database.ManageContainer(cfg, database.ContainerStart); err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func TestRecreateContainerKeepsVolume(t *testing.T) {
+	driver := containertest.NewFake()
+	cfg := volumeConfig(t, driver)
+
+	cfg.Image = "postgres:17"
+	if err := database.ManageContainer(cfg, database.ContainerRecreate); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := driver.Find("remove local_postgres"); !ok {
+		t.Errorf("container not removed, got %q", driver.Lines())
+	}
+	if _, ok := driver.Find("run local_postgres postgres:17 5432:5432 local_postgres_data:"); !ok {
+		t.Errorf("container not created from the new image with the volume, got %q", driver.Lines())
+	}
+	if _, ok := driver.Find("remove-volume"); ok || !driver.HasVolume("local_postgres_data") {
+		t.Error("volume must be kept")
+	}
+}
+
+func TestDestroyContainerRemovesVolume(t *testing.T) {
+	driver := containertest.NewFake()
+	cfg := volumeConfig(t, driver)
+
+	if err := database.ManageContainer(cfg, database.ContainerDestroy); err != nil {
+		t.Fatal(err)
+	}
+	if driver.HasVolume("local_postgres_data") {
+		t.Error("volume not removed")
+	}
+
+	// Destroying again finds nothing to remove
+	if err := database.ManageContainer(cfg, database.ContainerDestroy); err != nil {
+		t.Errorf("destroying a missing container: %v", err)
+	}
+}
+
+func TestStopMissingContainer(t *testing.T) {
+	err := database.ManageContainer(localConfig(containertest.NewFake()), database.ContainerStop)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestContainerStatusReportsDiskUsage(t *testing.T) {
+	driver := containertest.NewFake().
+		SetState("local_postgres", container.State{Exists: true, Running: true, Status: "running", Image: "postgres:15"}).
+		On("du -sk", containertest.Response{Stdout: "2048\t/var/lib/postgresql/data\n"}).
+		On("pg_database_size", containertest.Response{Stdout: "dev|1048576\npostgres|7000000\n"})
+
+	status, err := database.GetContainerStatus(localConfig(driver))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.State != "running" || status.Image != "postgres:15" || status.Port != 5432 {
+		t.Errorf("unexpected status %+v", status)
+	}
+	if status.DiskUsage != 2048*1024 {
+		t.Errorf("expected disk usage of 2 MiB, got %d", status.DiskUsage)
+	}
+	if len(status.Databases) != 2 || status.Databases[0] != (database.DatabaseSize{Name: "dev", Size: 1048576}) {
+		t.Errorf("unexpected database sizes %+v", status.Databases)
+	}
+}
+
+func TestContainerStatusOfMissingContainer(t *testing.T) {
+	status, err := database.GetContainerStatus(localConfig(containertest.NewFake()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.State != database.StateMissing || status.DiskUsage != -1 {
+		t.Errorf("unexpected status %+v", status)
+	}
+}
+
+func TestContainerActionsRejectNativeMode(t *testing.T) {
+	if err := database.ManageContainer(nativeConfig(databasetest.NewRecorder()), database.ContainerStop); err == nil {
+		t.Error("expected error in native mode")
+	}
+}
@@ -0,0 +1,375 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"dumper/container"
+)
+
+// dataDir is where the data directory volume is mounted in the container
+const dataDir = "/var/lib/postgresql/data"
+
+// clientMessages keeps notices like "table does not exist, skipping" from --if-exists out of the output
+const clientMessages = "PGOPTIONS=-c client_min_messages=warning"
+
+// localServer runs PostgreSQL tools against the local server dumps are loaded into.
+// Connection settings are passed through the environment, so commands only name the database.
+type localServer interface {
+	// start makes sure the server is running and accepts connections
+	start(ctx context.Context, dbName string) error
+
+	// exec runs a command. Stderr goes to the configured output and is included
+	// in the returned error, stdout is shown only in debug mode.
+	exec(ctx context.Context, stdin io.Reader, cmd ...string) error
+
+	// execFiltered runs a command like exec, with stderr passed through the filter first
+	execFiltered(ctx context.Context, stdin io.Reader, filter func(stderr io.Writer) io.Writer, cmd ...string) error
+
+	// output runs a command and returns its stdout
+	output(ctx context.Context, cmd ...string) ([]byte, error)
+
+	// archivePath makes the archive available to pg_restore and returns its path for it.
+	// The returned function removes the copy, if one was made.
+	archivePath(ctx context.Context, dumpFile string) (string, func(), error)
+}
+
+func newLocalServer(cfg PostgresConfig) (localServer, error) {
+	if cfg.NativeDSN != "" {
+		return newNativeServer(cfg)
+	}
+
+	driver := cfg.Driver
+	if driver == nil {
+		var err error
+		if driver, err = container.New(cfg.Runtime); err != nil {
+			return nil, err
+		}
+	}
+	return &localContainer{driver: driver, cfg: cfg}, nil
+}
+
+// outputWriters returns writers for stdout and stderr of a command following localServer.exec rules,
+// stderr is also captured into the returned buffer
+func outputWriters(cfg PostgresConfig, stdout io.Writer) (io.Writer, io.Writer, *bytes.Buffer) {
+	if stdout == nil {
+		stdout = io.Discard
+		if cfg.Debug && cfg.Output != nil {
+			stdout = cfg.Output
+		}
+	}
+
+	stderr := &bytes.Buffer{}
+	if cfg.Output != nil {
+		return stdout, io.MultiWriter(stderr, cfg.Output), stderr
+	}
+	return stdout, stderr, stderr
+}
+
+// withStderr adds captured stderr to the error of a command
+func withStderr(err error, stderr *bytes.Buffer) error {
+	if msg := strings.TrimSpace(stderr.String()); msg != "" {
+		return fmt.Errorf("%w: %s", err, msg)
+	}
+	return err
+}
+
+// localContainer runs commands in the local PostgreSQL container
+type localContainer struct {
+	driver container.Driver
+	cfg    PostgresConfig
+}
+
+func (c *localContainer) start(ctx context.Context, dbName string) error {
+	// Check if container is running
+	state, err := c.driver.Inspect(c.cfg.ContainerName)
+	if err != nil {
+		return err
+	}
+	if state.Running {
+		return nil
+	}
+
+	if state.Exists {
+		debugPrintf(c.cfg.Output, c.cfg.Debug, "Container is stopped, starting...\n")
+		err = c.driver.Start(c.cfg.ContainerName)
+		if errors.Is(err, container.ErrPortInUse) && c.cfg.Volume != "" {
+			// Published ports can't be changed, the container is created again on a free port.
+			// Data stays in the volume.
+			c.logf("Port %d is in use, recreating container %s...\n", c.port(), c.cfg.ContainerName)
+			if err = c.driver.Remove(c.cfg.ContainerName); err == nil {
+				err = startContainer(ctx, c, dbName)
+			}
+		}
+	} else {
+		debugPrintf(c.cfg.Output, c.cfg.Debug, "Container is not running, starting...\n")
+		err = startContainer(ctx, c, dbName)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to start container: %w", err)
+	}
+
+	// Wait for PostgreSQL to start in container
+	if err := waitForPostgres(ctx, c); err != nil {
+		return fmt.Errorf("PostgreSQL failed to start: %w", err)
+	}
+	return nil
+}
+
+// port returns the configured host port of the container
+func (c *localContainer) port() int {
+	if c.cfg.Port == 0 {
+		return 5432
+	}
+	return c.cfg.Port
+}
+
+// logf writes a message to the configured output
+func (c *localContainer) logf(format string, a ...interface{}) {
+	if c.cfg.Output != nil {
+		fmt.Fprintf(c.cfg.Output, format, a...)
+	}
+}
+
+func (c *localContainer) exec(ctx context.Context, stdin io.Reader, cmd ...string) error {
+	return c.run(ctx, stdin, nil, nil, cmd)
+}
+
+func (c *localContainer) execFiltered(ctx context.Context, stdin io.Reader, filter func(stderr io.Writer) io.Writer, cmd ...string) error {
+	return c.run(ctx, stdin, nil, filter, cmd)
+}
+
+func (c *localContainer) output(ctx context.Context, cmd ...string) ([]byte, error) {
+	var stdout bytes.Buffer
+	err := c.run(ctx, nil, &stdout, nil, cmd)
+	return stdout.Bytes(), err
+}
+
+func (c *localContainer) run(ctx context.Context, stdin io.Reader, stdout io.Writer, filter func(io.Writer) io.Writer, cmd []string) error {
+	stdout, stderrWriter, stderr := outputWriters(c.cfg, stdout)
+	if filter != nil {
+		stderrWriter = filter(stderrWriter)
+	}
+
+	debugPrintf(c.cfg.Output, c.cfg.Debug, "$ %s %s\n", c.cfg.ContainerName, strings.Join(cmd, " "))
+	err := c.driver.Exec(ctx, c.cfg.ContainerName, container.Exec{
+		Cmd:    cmd,
+		Env:    []string{"PGUSER=postgres", clientMessages},
+		Stdin:  stdin,
+		Stdout: stdout,
+		Stderr: stderrWriter,
+	})
+	if err != nil {
+		return withStderr(err, stderr)
+	}
+	return nil
+}
+
+// archivePath copies the archive into the container, it is removed by the returned function
+func (c *localContainer) archivePath(ctx context.Context, dumpFile string) (string, func(), error) {
+	containerPath := "/tmp/" + filepath.Base(dumpFile)
+
+	if err := c.driver.CopyTo(c.cfg.ContainerName, dumpFile, containerPath); err != nil {
+		return "", nil, fmt.Errorf("error copying dump into container: %w", err)
+	}
+
+	cleanup := func() {
+		// Also removed when the restore is cancelled
+		if err := c.exec(context.Background(), nil, "rm", "-rf", containerPath); err != nil {
+			debugPrintf(c.cfg.Output, c.cfg.Debug, "Warning: failed to remove dump from container: %v\n", err)
+		}
+	}
+	return containerPath, cleanup, nil
+}
+
+// maxPortAttempts limits how many ports after the configured one are tried
+const maxPortAttempts = 10
+
+// startContainer starts a new PostgreSQL container, pulling the image if it is missing.
+// If the configured port is taken, the next free one is used and reported with OnPortChange.
+func startContainer(ctx context.Context, c *localContainer, dbName string) error {
+	spec := container.Spec{
+		Name:  c.cfg.ContainerName,
+		Image: c.cfg.Image,
+		Env: []string{
+			"POSTGRES_PASSWORD=" + c.cfg.Password,
+			"POSTGRES_DB=" + dbName,
+		},
+	}
+	if c.cfg.Volume != "" {
+		// Data lives in a subdirectory, so that initdb doesn't trip over the volume's root
+		spec.Env = append(spec.Env, "PGDATA="+dataDir+"/pgdata")
+		spec.Volumes = map[string]string{c.cfg.Volume: dataDir}
+	}
+
+	available := c.cfg.PortAvailable
+	if available == nil {
+		available = portAvailable
+	}
+
+	var err error
+	for port := c.port(); port < c.port()+maxPortAttempts; port++ {
+		if !available(port) {
+			debugPrintf(c.cfg.Output, c.cfg.Debug, "Port %d is in use\n", port)
+			continue
+		}
+
+		spec.Ports = map[int]int{5432: port}
+		err = runContainer(c, spec)
+		if errors.Is(err, container.ErrPortInUse) {
+			// Taken by something the check can't see, e.g. another container that is starting
+			continue
+		}
+		if err == nil && port != c.port() {
+			c.logf("Port %d is in use, container %s is published on port %d\n", c.port(), c.cfg.ContainerName, port)
+			if c.cfg.OnPortChange != nil {
+				c.cfg.OnPortChange(port)
+			}
+		}
+		return err
+	}
+
+	if err == nil {
+		err = container.ErrPortInUse
+	}
+	return fmt.Errorf("no free port in %d-%d: %w", c.port(), c.port()+maxPortAttempts-1, err)
+}
+
+// runContainer creates the container, pulling the image if it is missing
+func runContainer(c *localContainer, spec container.Spec) error {
+	debugPrintf(c.cfg.Output, c.cfg.Debug, "Starting container %s...\n", c.cfg.ContainerName)
+	err := c.driver.Run(spec)
+	if errors.Is(err, container.ErrImageNotFound) {
+		c.logf("Pulling image %s...\n", c.cfg.Image)
+		if err := c.driver.Pull(c.cfg.Image); err != nil {
+			return err
+		}
+		err = c.driver.Run(spec)
+	}
+	return err
+}
+
+// portAvailable reports whether the host port can be published. Both the wildcard and
+// the loopback address are checked, since a local server often listens on loopback only.
+func portAvailable(port int) bool {
+	for _, addr := range []string{fmt.Sprintf(":%d", port), fmt.Sprintf("127.0.0.1:%d", port)} {
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			return false
+		}
+		l.Close()
+	}
+	return true
+}
+
+// waitForPostgres waits until PostgreSQL in container becomes available
+func waitForPostgres(ctx context.Context, c *localContainer) error {
+	debugPrintf(c.cfg.Output, c.cfg.Debug, "Waiting for PostgreSQL to accept connections (pg_isready)...\n")
+	for i := 0; i < c.cfg.MaxWaitSeconds; i++ {
+		if _, err := c.output(ctx, "pg_isready"); err == nil {
+			debugPrintf(c.cfg.Output, c.cfg.Debug, "PostgreSQL is ready!\n")
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+	return fmt.Errorf("timeout after %d seconds", c.cfg.MaxWaitSeconds)
+}
+
+// nativeServer runs host PostgreSQL tools against an already running server
+type nativeServer struct {
+	runner *runner
+	cfg    PostgresConfig
+	env    []string
+	addr   string
+}
+
+func newNativeServer(cfg PostgresConfig) (*nativeServer, error) {
+	u, err := url.Parse(cfg.NativeDSN)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing local DSN: %w", err)
+	}
+
+	// Connection settings are passed as libpq environment variables, since dropdb and createdb
+	// take the database name as an argument rather than a connection string
+	env := []string{clientMessages}
+	if host := u.Hostname(); host != "" {
+		env = append(env, "PGHOST="+host)
+	}
+	if port := u.Port(); port != "" {
+		env = append(env, "PGPORT="+port)
+	}
+	if user := u.User.Username(); user != "" {
+		env = append(env, "PGUSER="+user)
+	}
+	if password, ok := u.User.Password(); ok && password != "" {
+		env = append(env, "PGPASSWORD="+password)
+	}
+	if sslMode := u.Query().Get("sslmode"); sslMode != "" {
+		env = append(env, "PGSSLMODE="+sslMode)
+	}
+
+	return &nativeServer{
+		runner: newRunner(cfg.Executor, cfg.Debug, cfg.Output),
+		cfg:    cfg,
+		env:    env,
+		addr:   u.Host,
+	}, nil
+}
+
+func (n *nativeServer) start(ctx context.Context, dbName string) error {
+	if _, err := n.output(ctx, "pg_isready"); err != nil {
+		return fmt.Errorf("local PostgreSQL is not available at %s: %w", n.addr, err)
+	}
+	return nil
+}
+
+func (n *nativeServer) exec(ctx context.Context, stdin io.Reader, cmd ...string) error {
+	return n.run(ctx, stdin, nil, nil, cmd)
+}
+
+func (n *nativeServer) execFiltered(ctx context.Context, stdin io.Reader, filter func(stderr io.Writer) io.Writer, cmd ...string) error {
+	return n.run(ctx, stdin, nil, filter, cmd)
+}
+
+func (n *nativeServer) output(ctx context.Context, cmd ...string) ([]byte, error) {
+	var stdout bytes.Buffer
+	err := n.run(ctx, nil, &stdout, nil, cmd)
+	return stdout.Bytes(), err
+}
+
+func (n *nativeServer) run(ctx context.Context, stdin io.Reader, stdout io.Writer, filter func(io.Writer) io.Writer, cmd []string) error {
+	stdout, stderrWriter, stderr := outputWriters(n.cfg, stdout)
+	if filter != nil {
+		stderrWriter = filter(stderrWriter)
+	}
+
+	err := n.runner.Run(ctx, Command{
+		Name:   cmd[0],
+		Args:   cmd[1:],
+		Env:    n.env,
+		Stdin:  stdin,
+		Stdout: stdout,
+		Stderr: stderrWriter,
+	})
+	if err != nil {
+		return withStderr(err, stderr)
+	}
+	return nil
+}
+
+// archivePath returns the dump itself, host tools read it directly
+func (n *nativeServer) archivePath(ctx context.Context, dumpFile string) (string, func(), error) {
+	return dumpFile, func() {}, nil
+}
@@ -0,0 +1,22 @@
+package database
+
+import (
+	"net"
+	"testing"
+)
+
+func TestPortAvailable(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+
+	if portAvailable(port) {
+		t.Errorf("port %d taken on loopback reported as available", port)
+	}
+	l.Close()
+	if !portAvailable(port) {
+		t.Errorf("port %d reported as taken after it was released", port)
+	}
+}
@@ -0,0 +1,142 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+)
+
+// PipeOptions configures how a database is copied without an intermediate dump file
+type PipeOptions struct {
+	// DumpOptions of the source side. The copy is always plain SQL, so Format, Jobs
+	// and Compression are not supported. ExpectedSize is compared with the streamed bytes.
+	DumpOptions
+
+	// MatchServerVersion creates a missing local container from the image
+	// of the source server's major version
+	MatchServerVersion bool
+}
+
+// PipeDatabase streams pg_dump output of the source database straight into psql of the local
+// database, without writing a dump file. The local database is recreated first.
+// When ctx is cancelled, both tools are stopped and the half-restored database is dropped.
+func PipeDatabase(ctx context.Context, dsn string, cfg PostgresConfig, dbName string, opts PipeOptions) (DumpInfo, error) {
+	if opts.Format != "" && opts.Format != FormatPlain {
+		return DumpInfo{}, fmt.Errorf("copy streams plain SQL, %s format is not supported", opts.Format)
+	}
+	if opts.Compression != CompressionNone {
+		return DumpInfo{}, fmt.Errorf("copy streams plain SQL, compression is not supported")
+	}
+	if err := checkSubset(opts.DumpOptions); err != nil {
+		return DumpInfo{}, err
+	}
+
+	r := newRunner(opts.Executor, opts.Debug, opts.Output)
+	version, err := checkSourceVersion(ctx, r, dsn, opts.DumpOptions)
+	if err != nil {
+		return DumpInfo{}, err
+	}
+	if err := checkSourceTables(ctx, r, dsn, opts.DumpOptions); err != nil {
+		return DumpInfo{}, err
+	}
+
+	// Image only matters when the container is created, a running one is checked below
+	if opts.MatchServerVersion {
+		cfg.Image = ImageForVersion(cfg.Image, version)
+	}
+	server, err := newLocalServer(cfg)
+	if err != nil {
+		return DumpInfo{}, err
+	}
+
+	opts.Progress.setStage("starting server")
+	if err := server.start(ctx, dbName); err != nil {
+		if ctx.Err() != nil {
+			return DumpInfo{}, fmt.Errorf("copy cancelled: %w", ctx.Err())
+		}
+		return DumpInfo{}, err
+	}
+	checkLocalVersion(ctx, server, cfg, version)
+
+	debugPrintf(cfg.Output, cfg.Debug, "Copying database into %s...\n", dbName)
+	if err := recreateDatabase(ctx, server, cfg, dbName); err != nil {
+		if ctx.Err() != nil {
+			return DumpInfo{}, fmt.Errorf("copy cancelled: %w", ctx.Err())
+		}
+		return DumpInfo{}, err
+	}
+
+	if err := pipeDump(ctx, r, dsn, server, dbName, opts.DumpOptions); err != nil {
+		if ctx.Err() != nil {
+			// The restore may still hold connections, the cleanup must not be cancelled too
+			opts.Progress.setStage("cleaning up")
+			dropDatabase(context.Background(), server, cfg, dbName)
+			return DumpInfo{}, fmt.Errorf("copy cancelled: %w", ctx.Err())
+		}
+		return DumpInfo{}, err
+	}
+
+	opts.Progress.setStage("checking tables")
+	count, err := countTables(ctx, server, dbName, opts.Schemas)
+	if err != nil {
+		return DumpInfo{}, err
+	}
+	debugPrintf(cfg.Output, cfg.Debug, "\nNumber of tables in database: %d\n", count)
+	if count == 0 {
+		return DumpInfo{}, fmt.Errorf("no tables in database after copy")
+	}
+
+	return DumpInfo{ServerVersion: version}, nil
+}
+
+// pipeDump runs pg_dump, or the subset dump, and psql connected by a pipe.
+// Bytes and tables are reported to progress as psql reads them.
+func pipeDump(ctx context.Context, r *runner, dsn string, server localServer, dbName string, opts DumpOptions) error {
+	produce := func(w io.Writer) error {
+		return writeSubset(ctx, r, dsn, w, opts)
+	}
+	if opts.Subset == nil {
+		// Tables are taken from the SQL read by psql, pg_dump doesn't need --verbose
+		dumpOpts := opts
+		dumpOpts.Progress = nil
+		cmd, err := pgDumpCommand(dsn, FormatPlain, "", dumpOpts)
+		if err != nil {
+			return err
+		}
+		produce = func(w io.Writer) error {
+			// Without a dump file the error would only say that pg_dump exited
+			stderr := &bytes.Buffer{}
+			cmd.Stdout, cmd.Stderr = w, stderr
+			if opts.Output != nil {
+				cmd.Stderr = io.MultiWriter(stderr, opts.Output)
+			}
+			if err := r.Run(ctx, cmd); err != nil {
+				return fmt.Errorf("error creating dump: %w", withStderr(err, stderr))
+			}
+			return nil
+		}
+	}
+
+	opts.Progress.setStage("copying")
+	opts.Progress.setTotal(opts.ExpectedSize)
+
+	pr, pw := io.Pipe()
+	dumped := make(chan error, 1)
+	go func() {
+		err := writeFiltered(pw, opts.Filter, produce)
+		pw.CloseWithError(err)
+		dumped <- err
+	}()
+
+	sql := &copyReader{r: &countingReader{r: pr, progress: opts.Progress}, progress: opts.Progress}
+	restoreErr := server.exec(ctx, sql, "psql", "-d", dbName)
+	pr.Close() // unblock the dump if psql stopped reading early
+	dumpErr := <-dumped
+
+	// A failed psql stops reading, which fails the dump too, so its error is the cause
+	if restoreErr != nil {
+		return fmt.Errorf("error restoring SQL: %w", restoreErr)
+	}
+	return dumpErr
+}
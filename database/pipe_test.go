@@ -0,0 +1,98 @@
+package database_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"dumper/container/containertest"
+	"dumper/database"
+	"dumper/database/databasetest"
+)
+
+func TestPipeStreamsDumpIntoPsql(t *testing.T) {
+	const sql = "CREATE TABLE users ();\nCOPY public.users (id) FROM stdin;\n\\.\n"
+	rec := sourceServer().On("pg_dump --format", databasetest.Response{Stdout: sql})
+	driver := runningContainer()
+	progress := database.NewProgress()
+
+	opts := database.PipeOptions{DumpOptions: database.DumpOptions{Executor: rec, Progress: progress}}
+	info, err := database.PipeDatabase(context.Background(), sourceDSN, localConfig(driver), "dev", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.ServerVersion.String() != "16.2" {
+		t.Errorf("expected source version 16.2, got %s", info.ServerVersion)
+	}
+
+	dump, ok := rec.Find("pg_dump --format=plain")
+	if !ok {
+		t.Fatalf("pg_dump not run, got %q", rec.CommandLines())
+	}
+	for _, arg := range dump.Args {
+		if strings.HasPrefix(arg, "--file=") {
+			t.Errorf("pg_dump must write to stdout, got %s", arg)
+		}
+	}
+	restore, ok := driver.Find("exec local_postgres psql -d dev")
+	if !ok {
+		t.Fatalf("psql restore not run, got %q", driver.Lines())
+	}
+	if restore.Input != sql {
+		t.Errorf("dump not piped to stdin, got %q", restore.Input)
+	}
+
+	state := progress.State()
+	if state.Bytes != int64(len(sql)) || state.Tables != 1 {
+		t.Errorf("expected %d bytes of one table, got %d bytes of %d", len(sql), state.Bytes, state.Tables)
+	}
+}
+
+func TestPipeReportsDumpError(t *testing.T) {
+	rec := sourceServer().On("pg_dump --format", databasetest.Response{
+		Stderr: "pg_dump: error: connection lost",
+		Err:    errors.New("exit status 1"),
+	})
+	driver := runningContainer()
+
+	opts := database.PipeOptions{DumpOptions: database.DumpOptions{Executor: rec}}
+	_, err := database.PipeDatabase(context.Background(), sourceDSN, localConfig(driver), "dev", opts)
+	if err == nil || !strings.Contains(err.Error(), "connection lost") {
+		t.Fatalf("expected pg_dump error, got %v", err)
+	}
+	if _, ok := driver.Find("SELECT COUNT(*)"); ok {
+		t.Error("tables must not be checked after a failed dump")
+	}
+}
+
+func TestPipeRejectsArchiveFormat(t *testing.T) {
+	rec := sourceServer()
+	driver := runningContainer()
+
+	opts := database.PipeOptions{DumpOptions: database.DumpOptions{Format: database.FormatCustom, Executor: rec}}
+	if _, err := database.PipeDatabase(context.Background(), sourceDSN, localConfig(driver), "dev", opts); err == nil {
+		t.Fatal("expected error for custom format")
+	}
+	if calls := rec.Calls(); len(calls) != 0 {
+		t.Errorf("nothing must run, got %q", rec.CommandLines())
+	}
+}
+
+func TestCancelledPipeDropsDatabase(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rec := sourceServer().On("pg_dump --format", databasetest.Response{Stdout: "SELECT 1;\n"})
+	driver := runningContainer().
+		On("psql -d dev", containertest.Response{Do: cancel})
+
+	opts := database.PipeOptions{DumpOptions: database.DumpOptions{Executor: rec}}
+	_, err := database.PipeDatabase(ctx, sourceDSN, localConfig(driver), "dev", opts)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected cancelled copy, got %v", err)
+	}
+	lines := driver.Lines()
+	if last := lines[len(lines)-1]; last != "exec local_postgres dropdb --if-exists dev" {
+		t.Errorf("half-copied database not dropped, got %q", lines)
+	}
+}
@@ -1,181 +1,568 @@
 package database
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
+	"strconv"
 	"strings"
 	"time"
+
+	"dumper/container"
 )
 
 type PostgresConfig struct {
 	ContainerName  string
 	Image          string
 	Password       string
+	Port           int    // host port the container publishes PostgreSQL on, 5432 if zero
+	Volume         string // named volume keeping the data directory, none if empty
 	MaxWaitSeconds int
 	Debug          bool
+	Runtime        string           // docker, podman or nerdctl, detected if empty
+	Driver         container.Driver // overrides Runtime, e.g. in tests
+	Output         io.Writer        // receives output of commands run against the local server
+
+	// OnPortChange is called when the container is published on another port than Port,
+	// because Port is taken, e.g. by a natively installed PostgreSQL
+	OnPortChange  func(port int)
+	PortAvailable func(port int) bool // checks host ports before publishing, overridden in tests
+
+	// NativeDSN is a connection to an already running local server. When it is set,
+	// dumps are loaded into this server with host tools instead of a container.
+	NativeDSN string
+	Executor  Executor // runs host tools in native mode, real processes if nil
+}
+
+// debugPrintf writes debug information to w only if debug mode is enabled.
+// Nothing is printed to stdout, which belongs to the terminal UI.
+func debugPrintf(w io.Writer, debug bool, format string, a ...interface{}) {
+	if debug && w != nil {
+		fmt.Fprintf(w, format, a...)
+	}
+}
+
+// DumpOptions configures how a dump is created
+type DumpOptions struct {
+	Format   DumpFormat
+	Jobs     int // parallel jobs, only used by directory format
+	Debug    bool
+	Executor Executor // runs PostgreSQL tools, real processes if nil
+
+	// Schemas to dump, only public by default
+	Schemas []string
+
+	// Table filters, passed to pg_dump as --table, --exclude-table and --exclude-table-data
+	IncludeTables    []string
+	ExcludeTables    []string
+	ExcludeTableData []string
+
+	// Filter transforms pg_dump output before it is written to the dump file,
+	// only supported for plain format
+	Filter func(r io.Reader, w io.Writer) error
+
+	// Subset dumps only rows reachable from the subset root, only supported for plain format
+	Subset *Subset
+
+	// Compression of the dump file, only supported for plain format
+	Compression Compression
+
+	// Output receives warnings, e.g. about pg_dump older than the server
+	Output io.Writer
+
+	// Progress is updated while the dump is written, if set.
+	// ExpectedSize, e.g. the size of the previous dump, is used to estimate the time left.
+	Progress     *Progress
+	ExpectedSize int64
+}
+
+// DumpInfo describes a created dump
+type DumpInfo struct {
+	ServerVersion Version // version of the source server
+}
+
+// RestoreOptions configures how a dump is restored
+type RestoreOptions struct {
+	Jobs          int      // parallel jobs for pg_restore
+	Schemas       []string // schemas checked for tables after restore, only public by default
+	SourceVersion Version  // version of the server the dump was made from, if known
+	Progress      *Progress
+}
+
+// DumpDatabase creates a database dump.
+// When ctx is cancelled, pg_dump is stopped and the partial dump is removed.
+func DumpDatabase(ctx context.Context, dsn string, dumpFile string, opts DumpOptions) (DumpInfo, error) {
+	if err := checkSubset(opts); err != nil {
+		return DumpInfo{}, err
+	}
+	r := newRunner(opts.Executor, opts.Debug, opts.Output)
+
+	version, err := checkSourceVersion(ctx, r, dsn, opts)
+	if err != nil {
+		return DumpInfo{}, err
+	}
+
+	if err := dumpDatabase(ctx, r, dsn, dumpFile, opts); err != nil {
+		if ctx.Err() != nil {
+			if removeErr := os.RemoveAll(dumpFile); removeErr != nil {
+				debugPrintf(opts.Output, opts.Debug, "Warning: failed to remove partial dump: %v\n", removeErr)
+			}
+			return DumpInfo{}, fmt.Errorf("dump cancelled: %w", ctx.Err())
+		}
+		return DumpInfo{}, err
+	}
+	return DumpInfo{ServerVersion: version}, nil
 }
 
-// debugPrintf prints debug information only if debug mode is enabled
-func debugPrintf(debug bool, format string, a ...interface{}) {
-	if debug {
-		fmt.Printf(format, a...)
+// checkSourceVersion returns version of the source server, warning if pg_dump is older.
+// pg_dump refuses to dump a server of a newer major version.
+func checkSourceVersion(ctx context.Context, r *runner, dsn string, opts DumpOptions) (Version, error) {
+	version, err := queryServerVersion(ctx, r, dsn)
+	if err != nil {
+		return 0, fmt.Errorf("error checking source server version: %w", err)
+	}
+	debugPrintf(opts.Output, opts.Debug, "Source server version: %s\n", version)
+	if local, err := pgDumpVersion(ctx, r); err != nil {
+		debugPrintf(opts.Output, opts.Debug, "Warning: failed to check pg_dump version: %v\n", err)
+	} else if local.OlderMajor(version) && opts.Output != nil {
+		fmt.Fprintf(opts.Output, "Warning: pg_dump %s is older than the source server %s, install PostgreSQL %s client tools\n",
+			local, version, version.Major())
 	}
+	return version, nil
 }
 
-// debugCmd executes command with stdout/stderr output only in debug mode
-func debugCmd(cmd *exec.Cmd, debug bool) error {
-	if debug {
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
+// checkSourceTables makes sure the source database is reachable, reporting its tables to progress
+func checkSourceTables(ctx context.Context, r *runner, dsn string, opts DumpOptions) error {
+	checkCmd, err := pgCommand("psql", dsn, "-X", "-t", "-c", countTablesQuery(opts.Schemas))
+	if err != nil {
+		return err
 	}
-	return cmd.Run()
+	tables, err := r.Output(ctx, checkCmd)
+	if err != nil {
+		return fmt.Errorf("error checking tables in source database: %w", err)
+	}
+	if n, err := strconv.Atoi(strings.TrimSpace(string(tables))); err == nil {
+		opts.Progress.setTotalTables(n)
+	}
+	return nil
 }
 
-// DumpDatabase creates a database dump
-func DumpDatabase(dsn string, dumpFile string, debug bool) error {
+func dumpDatabase(ctx context.Context, r *runner, dsn string, dumpFile string, opts DumpOptions) error {
 	// First check if there are tables in source database
-	checkCmd := exec.Command("bash", "-c",
-		fmt.Sprintf("psql '%s' -t -c \"SELECT COUNT(*) FROM pg_tables WHERE schemaname = 'public';\"",
-			dsn))
-	output, err := checkCmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("error checking tables in source database: %w\nOutput: %s", err, string(output))
-	}
-
-	// Create dump with additional options
-	cmdString := fmt.Sprintf(
-		"pg_dump "+
-			"--format=plain "+ // Plain text format
-			"--no-owner "+ // No owners
-			"--no-privileges "+ // No privileges
-			"--clean "+ // Clean before restore
-			"--if-exists "+ // Add IF EXISTS to DROP
-			"--schema=public "+ // Only public schema
-			"--disable-triggers "+ // Disable triggers during restore
-			"'%s' > %s",
-		dsn, dumpFile)
-
-	cmd := exec.Command("bash", "-c", cmdString)
-	if debug {
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-	}
-
-	if err := cmd.Run(); err != nil {
+	if err := checkSourceTables(ctx, r, dsn, opts); err != nil {
+		return err
+	}
+
+	format := opts.Format
+	if format == "" {
+		format = FormatPlain
+	}
+
+	if opts.Compression != CompressionNone && format != FormatPlain {
+		return fmt.Errorf("compression is only supported for plain format, %s format is compressed by pg_dump", format)
+	}
+
+	opts.Progress.setStage("dumping")
+	opts.Progress.setTotal(opts.ExpectedSize)
+	defer watchSize(dumpFile, opts.Progress)()
+
+	if opts.Subset != nil {
+		return writeDumpFile(dumpFile, opts, func(w io.Writer) error {
+			return writeSubset(ctx, r, dsn, w, opts)
+		})
+	}
+
+	// pg_dump refuses to write a directory archive into an existing directory
+	if format == FormatDirectory {
+		if err := os.RemoveAll(dumpFile); err != nil {
+			return fmt.Errorf("error removing old dump: %w", err)
+		}
+	}
+
+	// Filtered or compressed output is written by us rather than pg_dump
+	streamed := opts.Filter != nil || opts.Compression != CompressionNone
+	if streamed && format != FormatPlain {
+		return fmt.Errorf("dump filters are only supported for plain format")
+	}
+	file := dumpFile
+	if streamed {
+		file = ""
+	}
+	cmd, err := pgDumpCommand(dsn, format, file, opts)
+	if err != nil {
+		return err
+	}
+
+	if streamed {
+		return writeDumpFile(dumpFile, opts, func(w io.Writer) error {
+			cmd.Stdout = w
+			if err := r.Run(ctx, cmd); err != nil {
+				return fmt.Errorf("error creating dump: %w", err)
+			}
+			return nil
+		})
+	}
+
+	if err := r.Run(ctx, cmd); err != nil {
 		return fmt.Errorf("error creating dump: %w", err)
 	}
 
 	return nil
 }
 
-// LoadDump loads dump into local database
-func LoadDump(cfg PostgresConfig, dbName string, dumpFile string) error {
-	// Check if container is running
-	checkCmd := exec.Command("docker", "ps", "-q", "-f", "name="+cfg.ContainerName)
-	output, err := checkCmd.Output()
-	if err != nil || len(output) == 0 {
-		// Container is not running, start it
-		debugPrintf(cfg.Debug, "Container is not running, starting...\n")
-		if err := startContainer(cfg, dbName); err != nil {
-			return fmt.Errorf("failed to start container: %w", err)
+// pgDumpCommand builds the pg_dump command, writing to stdout if file is empty
+func pgDumpCommand(dsn string, format DumpFormat, file string, opts DumpOptions) (Command, error) {
+	args := []string{
+		"--format=" + string(format),
+		"--no-owner",         // No owners
+		"--no-privileges",    // No privileges
+		"--disable-triggers", // Disable triggers during restore
+	}
+
+	if file != "" {
+		args = append(args, "--file="+file)
+	}
+	for _, schema := range schemasOrDefault(opts.Schemas) {
+		args = append(args, "--schema="+schema)
+	}
+	if format == FormatPlain {
+		// Keeps plain dumps loadable into an existing database by hand. Archives are only
+		// restored by pg_restore into a recreated empty database, which has nothing to clean.
+		args = append(args,
+			"--clean",     // Clean before restore
+			"--if-exists", // Add IF EXISTS to DROP
+		)
+	}
+	if format == FormatDirectory && opts.Jobs > 1 {
+		args = append(args, fmt.Sprintf("--jobs=%d", opts.Jobs))
+	}
+	for _, pattern := range opts.IncludeTables {
+		args = append(args, "--table="+pattern)
+	}
+	for _, pattern := range opts.ExcludeTables {
+		args = append(args, "--exclude-table="+pattern)
+	}
+	for _, pattern := range opts.ExcludeTableData {
+		args = append(args, "--exclude-table-data="+pattern)
+	}
+
+	if opts.Progress != nil {
+		// Tables being dumped are taken from the verbose output
+		args = append(args, "--verbose")
+	}
+
+	cmd, err := pgCommand("pg_dump", dsn, args...)
+	if err != nil {
+		return Command{}, err
+	}
+	if opts.Progress != nil {
+		stderr := io.Discard
+		if opts.Output != nil {
+			stderr = opts.Output
 		}
+		cmd.Stderr = newVerboseWriter("pg_dump", stderr, opts.Progress)
+	}
+	return cmd, nil
+}
+
+// writeDumpFile writes output of produce through the dump filter and compressor into the dump file
+func writeDumpFile(dumpFile string, opts DumpOptions, produce func(w io.Writer) error) error {
+	f, err := createDumpFile(dumpFile, opts.Compression)
+	if err != nil {
+		return err
+	}
+	defer f.file.Close()
+
+	if err := writeFiltered(f, opts.Filter, produce); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// writeFiltered writes output of produce into w, through the dump filter if there is one
+func writeFiltered(w io.Writer, filter func(r io.Reader, w io.Writer) error, produce func(w io.Writer) error) error {
+	if filter == nil {
+		return produce(w)
+	}
+
+	// Run the output through the filter
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		err := filter(pr, w)
+		pr.CloseWithError(err) // unblock the producer if filter stopped early
+		done <- err
+	}()
+
+	err := produce(pw)
+	pw.CloseWithError(err)
+	if filterErr := <-done; filterErr != nil {
+		return fmt.Errorf("error processing dump: %w", filterErr)
+	}
+	return err
+}
 
-		// Wait for PostgreSQL to start in container
-		if err := waitForPostgres(cfg); err != nil {
-			return fmt.Errorf("PostgreSQL failed to start: %w", err)
+// LoadDump loads dump into local database.
+// When ctx is cancelled, the restore is stopped and the half-restored database is dropped.
+func LoadDump(ctx context.Context, cfg PostgresConfig, dbName string, dumpFile string, opts RestoreOptions) error {
+	server, err := newLocalServer(cfg)
+	if err != nil {
+		return err
+	}
+
+	opts.Progress.setStage("starting server")
+	if err := server.start(ctx, dbName); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("load cancelled: %w", ctx.Err())
 		}
+		return err
 	}
 
 	// Check if dump file exists
-	if _, err := os.Stat(dumpFile); os.IsNotExist(err) {
+	info, err := os.Stat(dumpFile)
+	if os.IsNotExist(err) {
 		return fmt.Errorf("dump file not found: %s", dumpFile)
 	}
+	if err != nil {
+		return fmt.Errorf("error reading dump file: %w", err)
+	}
+
+	format, err := DetectFormat(dumpFile)
+	if err != nil {
+		return fmt.Errorf("error detecting dump format: %w", err)
+	}
+
+	if opts.SourceVersion != 0 {
+		checkLocalVersion(ctx, server, cfg, opts.SourceVersion)
+	}
+
+	debugPrintf(cfg.Output, cfg.Debug, "Loading dump into database %s...\n", dbName)
+	debugPrintf(cfg.Output, cfg.Debug, "Dump %s: %d bytes, %s format\n", dumpFile, info.Size(), format)
+
+	if err := recreateDatabase(ctx, server, cfg, dbName); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("load cancelled: %w", ctx.Err())
+		}
+		return err
+	}
+
+	if err := restoreDump(ctx, server, dbName, dumpFile, format, info.Size(), opts); err != nil {
+		if ctx.Err() != nil {
+			// The restore may still hold connections, the cleanup must not be cancelled too
+			opts.Progress.setStage("cleaning up")
+			dropDatabase(context.Background(), server, cfg, dbName)
+			return fmt.Errorf("load cancelled: %w", ctx.Err())
+		}
+		return err
+	}
+
+	// Check number of tables
+	opts.Progress.setStage("checking tables")
+	count, err := countTables(ctx, server, dbName, opts.Schemas)
+	if err != nil {
+		return err
+	}
+	debugPrintf(cfg.Output, cfg.Debug, "\nNumber of tables in database: %d\n", count)
 
-	debugPrintf(cfg.Debug, "Loading dump into database %s...\n", dbName)
+	if count == 0 {
+		return fmt.Errorf("no tables in database after restore")
+	}
+
+	return nil
+}
 
-	// Show dump size only in debug mode
-	if cfg.Debug {
-		statCmd := exec.Command("ls", "-l", dumpFile)
-		statCmd.Stdout = os.Stdout
-		debugCmd(statCmd, cfg.Debug)
+// CountTables returns number of tables in the schemas of the local database.
+// The local server has to be running.
+func CountTables(ctx context.Context, cfg PostgresConfig, dbName string, schemas []string) (int, error) {
+	server, err := newLocalServer(cfg)
+	if err != nil {
+		return 0, err
 	}
+	return countTables(ctx, server, dbName, schemas)
+}
 
-	// Drop current database if it exists
-	dropCmd := exec.Command("bash", "-c",
-		fmt.Sprintf("docker exec %s dropdb -U postgres --if-exists %s",
-			cfg.ContainerName, dbName))
-	if err := debugCmd(dropCmd, cfg.Debug); err != nil {
-		debugPrintf(cfg.Debug, "Warning: failed to drop old database: %v\n", err)
+func countTables(ctx context.Context, server localServer, dbName string, schemas []string) (int, error) {
+	output, err := server.output(ctx, "psql", "-d", dbName, "-X", "-t", "-c", countTablesQuery(schemas))
+	if err != nil {
+		return 0, fmt.Errorf("error counting tables: %w", err)
 	}
+	count, err := strconv.Atoi(strings.TrimSpace(string(output)))
+	if err != nil {
+		return 0, fmt.Errorf("error counting tables: unexpected output %q", output)
+	}
+	return count, nil
+}
+
+// dropDatabase disconnects other sessions and drops the database if it exists.
+// A cancelled restore in the container keeps running, since the container runtime only
+// detaches from it, so sessions are terminated until none is left or stopTimeout passes.
+func dropDatabase(ctx context.Context, server localServer, cfg PostgresConfig, dbName string) {
+	// A database with active connections can't be dropped
+	query := fmt.Sprintf(
+		"SELECT count(pg_terminate_backend(pid)) FROM pg_stat_activity WHERE datname = %s AND pid <> pg_backend_pid()",
+		quoteLiteral(dbName))
+	deadline := time.Now().Add(stopTimeout)
+	for {
+		output, err := server.output(ctx, "psql", "-X", "-q", "-t", "-d", "postgres", "-c", query)
+		if err != nil {
+			debugPrintf(cfg.Output, cfg.Debug, "Warning: failed to terminate connections: %v\n", err)
+			break
+		}
+		if count, err := strconv.Atoi(strings.TrimSpace(string(output))); err != nil || count == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			debugPrintf(cfg.Output, cfg.Debug, "Warning: sessions of database %s are still running\n", dbName)
+			break
+		}
+		// Terminated sessions disappear asynchronously, the check is repeated until they are gone
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(terminateInterval):
+		}
+	}
+
+	if err := server.exec(ctx, nil, "dropdb", "--if-exists", dbName); err != nil {
+		debugPrintf(cfg.Output, cfg.Debug, "Warning: failed to drop database: %v\n", err)
+	}
+}
+
+// terminateInterval is how often dropDatabase checks whether terminated sessions are gone
+const terminateInterval = 100 * time.Millisecond
 
-	// Create new database
-	createCmd := exec.Command("bash", "-c",
-		fmt.Sprintf("docker exec %s createdb -U postgres %s",
-			cfg.ContainerName, dbName))
-	if err := debugCmd(createCmd, cfg.Debug); err != nil {
+// recreateDatabase drops the database if it exists and creates an empty one
+func recreateDatabase(ctx context.Context, server localServer, cfg PostgresConfig, dbName string) error {
+	dropDatabase(ctx, server, cfg, dbName)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := server.exec(ctx, nil, "createdb", dbName); err != nil {
 		return fmt.Errorf("error creating database: %w", err)
 	}
+	return nil
+}
 
-	// Restore data
-	restoreCmd := exec.Command("bash", "-c",
-		fmt.Sprintf("docker exec -i %s psql -U postgres -d %s < %s",
-			cfg.ContainerName, dbName, dumpFile))
-	if cfg.Debug {
-		restoreCmd.Stdout = os.Stdout
-		restoreCmd.Stderr = os.Stderr
+// restoreDump restores the dump into the created database
+func restoreDump(ctx context.Context, server localServer, dbName string, dumpFile string, format DumpFormat, size int64, opts RestoreOptions) error {
+	opts.Progress.setStage("restoring")
+	if format == FormatPlain {
+		opts.Progress.setTotal(size)
+		return restorePlain(ctx, server, dbName, dumpFile, opts.Progress)
 	}
+	return restoreArchive(ctx, server, dbName, dumpFile, opts)
+}
 
-	if err := restoreCmd.Run(); err != nil {
-		return fmt.Errorf("error restoring SQL: %w", err)
+// checkLocalVersion warns if the local server is older than the server the dump was made from
+func checkLocalVersion(ctx context.Context, server localServer, cfg PostgresConfig, source Version) {
+	output, err := server.output(ctx, "psql", "-X", "-t", "-A", "-d", "postgres", "-c", "SHOW server_version_num")
+	if err != nil {
+		debugPrintf(cfg.Output, cfg.Debug, "Warning: failed to check local server version: %v\n", err)
+		return
+	}
+	local, err := parseVersionNum(string(output))
+	if err != nil {
+		debugPrintf(cfg.Output, cfg.Debug, "Warning: %v\n", err)
+		return
 	}
 
-	// Check number of tables
-	statsCmd := exec.Command("bash", "-c",
-		fmt.Sprintf("docker exec %s psql -U postgres -d %s -t -c \""+
-			"SELECT COUNT(*) FROM pg_tables WHERE schemaname = 'public';\"",
-			cfg.ContainerName, dbName))
-	output, err = statsCmd.CombinedOutput()
+	if local.OlderMajor(source) && cfg.Output != nil {
+		fmt.Fprintf(cfg.Output, "Warning: dump of PostgreSQL %s is restored into older PostgreSQL %s\n", source, local)
+	}
+}
+
+// restorePlain streams a plain SQL dump, decompressing it if needed, into psql
+func restorePlain(ctx context.Context, server localServer, dbName string, dumpFile string, progress *Progress) error {
+	f, err := os.Open(dumpFile)
 	if err != nil {
-		return fmt.Errorf("error counting tables: %w\nOutput: %s", err, string(output))
+		return fmt.Errorf("error opening dump: %w", err)
 	}
+	defer f.Close()
 
-	count := strings.TrimSpace(string(output))
-	debugPrintf(cfg.Debug, "\nNumber of tables in database: %s\n", count)
+	// Bytes are counted before decompression to compare them with the file size
+	sql, closeReader, err := decompressReader(&countingReader{r: f, progress: progress})
+	if err != nil {
+		return err
+	}
+	defer closeReader()
+	sql = &copyReader{r: sql, progress: progress}
 
-	if count == "0" {
-		return fmt.Errorf("no tables in database after restore")
+	if err := server.exec(ctx, sql, "psql", "-d", dbName); err != nil {
+		return fmt.Errorf("error restoring SQL: %w", err)
 	}
 
 	return nil
 }
 
-// startContainer starts a new PostgreSQL container
-func startContainer(cfg PostgresConfig, dbName string) error {
-	cmd := exec.Command("docker", "run", "-d",
-		"--name", cfg.ContainerName,
-		"-e", "POSTGRES_PASSWORD="+cfg.Password,
-		"-e", fmt.Sprintf("POSTGRES_DB=%s", dbName),
-		"-p", "5432:5432",
-		cfg.Image,
-	)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	debugPrintf(cfg.Debug, "Starting container %s...\n", cfg.ContainerName)
-	return cmd.Run()
-}
-
-// waitForPostgres waits until PostgreSQL in container becomes available
-func waitForPostgres(cfg PostgresConfig) error {
-	debugPrintf(cfg.Debug, "Waiting for PostgreSQL to accept connections (pg_isready)...\n")
-	for i := 0; i < cfg.MaxWaitSeconds; i++ {
-		checkCmd := exec.Command("docker", "exec", cfg.ContainerName, "pg_isready", "-U", "postgres")
-		if err := checkCmd.Run(); err == nil {
-			debugPrintf(cfg.Debug, "PostgreSQL is ready!\n")
-			return nil
+// restoreArchive restores a custom or directory archive with pg_restore
+func restoreArchive(ctx context.Context, server localServer, dbName string, dumpFile string, opts RestoreOptions) error {
+	path, cleanup, err := server.archivePath(ctx, dumpFile)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	args := []string{
+		"pg_restore",
+		"-d", dbName,
+		"--no-owner",
+		"--no-privileges",
+	}
+	if opts.Jobs > 1 {
+		args = append(args, fmt.Sprintf("--jobs=%d", opts.Jobs))
+	}
+
+	var filter func(io.Writer) io.Writer
+	if opts.Progress != nil {
+		opts.Progress.setTotalTables(countArchiveTables(ctx, server, path))
+		args = append(args, "--verbose")
+		filter = func(stderr io.Writer) io.Writer {
+			return newVerboseWriter("pg_restore", stderr, opts.Progress)
 		}
-		time.Sleep(time.Second)
 	}
-	return fmt.Errorf("timeout after %d seconds", cfg.MaxWaitSeconds)
+	args = append(args, path)
+
+	if err := server.execFiltered(ctx, nil, filter, args...); err != nil {
+		return fmt.Errorf("error restoring archive: %w", err)
+	}
+
+	return nil
+}
+
+// countArchiveTables returns number of tables with data in the archive, 0 if it can't be read
+func countArchiveTables(ctx context.Context, server localServer, path string) int {
+	toc, err := server.output(ctx, "pg_restore", "--list", path)
+	if err != nil {
+		return 0
+	}
+	return bytes.Count(toc, []byte(" TABLE DATA "))
+}
+
+// schemasOrDefault returns schemas list, defaulting to public schema only
+func schemasOrDefault(schemas []string) []string {
+	if len(schemas) == 0 {
+		return []string{"public"}
+	}
+	return schemas
+}
+
+// countTablesQuery returns query counting tables in the given schemas
+func countTablesQuery(schemas []string) string {
+	return fmt.Sprintf("SELECT COUNT(*) FROM pg_tables WHERE schemaname IN (%s);", quoteList(schemasOrDefault(schemas)))
+}
+
+// quoteLiteral quotes value as SQL string literal
+func quoteLiteral(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+// quoteList quotes values as comma separated SQL string literals
+func quoteList(values []string) string {
+	quoted := make([]string, 0, len(values))
+	for _, value := range values {
+		quoted = append(quoted, quoteLiteral(value))
+	}
+	return strings.Join(quoted, ", ")
 }
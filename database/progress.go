@@ -0,0 +1,278 @@
+package database
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Progress tracks a running dump or restore. It is updated by the operation
+// and can be read from another goroutine, e.g. to draw a progress bar.
+type Progress struct {
+	mu          sync.Mutex
+	started     time.Time
+	stage       string
+	bytes       int64
+	total       int64
+	table       string
+	tables      int
+	totalTables int
+}
+
+// ProgressState is a snapshot of the progress
+type ProgressState struct {
+	Stage       string // what is being done, e.g. "restoring"
+	Bytes       int64  // bytes of the dump written or read so far
+	Total       int64  // expected size of the dump, 0 if unknown
+	Table       string // table being dumped or restored
+	Tables      int    // tables done
+	TotalTables int    // expected number of tables, 0 if unknown
+	Elapsed     time.Duration
+	ETA         time.Duration // 0 if unknown
+}
+
+// NewProgress starts tracking an operation
+func NewProgress() *Progress {
+	return &Progress{started: time.Now()}
+}
+
+// Reset starts tracking the next operation, e.g. a load after a dump
+func (p *Progress) Reset() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.started = time.Now()
+	p.stage, p.table = "", ""
+	p.bytes, p.total = 0, 0
+	p.tables, p.totalTables = 0, 0
+}
+
+// State returns the current progress
+func (p *Progress) State() ProgressState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	state := ProgressState{
+		Stage:       p.stage,
+		Bytes:       p.bytes,
+		Total:       p.total,
+		Table:       p.table,
+		Tables:      p.tables,
+		TotalTables: p.totalTables,
+		Elapsed:     time.Since(p.started),
+	}
+
+	// Bytes give a better estimate than tables, which differ a lot in size
+	switch {
+	case state.Total > 0 && state.Bytes > 0 && state.Bytes < state.Total:
+		state.ETA = time.Duration(float64(state.Elapsed) * float64(state.Total-state.Bytes) / float64(state.Bytes))
+	case state.TotalTables > 0 && state.Tables > 0 && state.Tables < state.TotalTables:
+		state.ETA = state.Elapsed * time.Duration(state.TotalTables-state.Tables) / time.Duration(state.Tables)
+	}
+	return state
+}
+
+// Progress methods are called on nil progress when it isn't tracked
+
+func (p *Progress) setStage(stage string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.table != "" {
+		p.tables++
+	}
+	p.stage = stage
+	p.table = ""
+}
+
+func (p *Progress) setBytes(n int64) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.bytes = n
+}
+
+func (p *Progress) addBytes(n int64) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.bytes += n
+}
+
+func (p *Progress) setTotal(total int64) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.total = total
+}
+
+func (p *Progress) setTotalTables(n int) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.totalTables = n
+}
+
+// startTable records that the table is being processed, the previous one is done
+func (p *Progress) startTable(table string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.table != "" {
+		p.tables++
+	}
+	p.table = table
+}
+
+// watchSize updates progress with the size of the dump file or directory
+// while it is written. The returned function stops watching.
+func watchSize(path string, p *Progress) func() {
+	if p == nil {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(500 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				p.setBytes(pathSize(path))
+				return
+			case <-ticker.C:
+				p.setBytes(pathSize(path))
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// pathSize returns size of a file or total size of files in a directory
+func pathSize(path string) int64 {
+	var size int64
+	filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+// countingReader counts bytes read from the dump file
+type countingReader struct {
+	r        io.Reader
+	progress *Progress
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.progress.addBytes(int64(n))
+	return n, err
+}
+
+// copyReader reports tables of COPY statements in a plain dump read by psql
+type copyReader struct {
+	r        io.Reader
+	progress *Progress
+}
+
+var copyStatement = []byte("\nCOPY ")
+
+func (c *copyReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+
+	// Statements split between reads are missed, the table is only informational
+	for chunk := p[:n]; ; {
+		i := bytes.Index(chunk, copyStatement)
+		if i < 0 {
+			break
+		}
+		chunk = chunk[i+len(copyStatement):]
+		if end := bytes.IndexAny(chunk, " \n"); end > 0 {
+			c.progress.startTable(string(chunk[:end]))
+		}
+	}
+	return n, err
+}
+
+// verboseTable matches pg_dump and pg_restore --verbose messages about table data
+var verboseTable = regexp.MustCompile(`(?:dumping contents of|processing data for) table "?([^"\n]+?)"?\s*$`)
+
+// verboseWriter takes --verbose messages of pg_dump or pg_restore out of their stderr,
+// reporting tables to progress. Errors and warnings are passed on to out.
+type verboseWriter struct {
+	prefix   string // tool name followed by ": "
+	out      io.Writer
+	progress *Progress
+	partial  []byte
+}
+
+func newVerboseWriter(tool string, out io.Writer, p *Progress) *verboseWriter {
+	return &verboseWriter{prefix: tool + ": ", out: out, progress: p}
+}
+
+func (w *verboseWriter) Write(p []byte) (int, error) {
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		line := string(w.partial[:i+1])
+		w.partial = w.partial[i+1:]
+
+		if w.isVerbose(line) {
+			if m := verboseTable.FindStringSubmatch(line); m != nil {
+				w.progress.startTable(m[1])
+			}
+			continue
+		}
+		if _, err := io.WriteString(w.out, line); err != nil {
+			return len(p), err
+		}
+	}
+}
+
+// isVerbose reports whether the line is an informational message rather than a problem
+func (w *verboseWriter) isVerbose(line string) bool {
+	message, ok := strings.CutPrefix(line, w.prefix)
+	if !ok {
+		return false
+	}
+	for _, problem := range []string{"error:", "warning:", "detail:", "hint:", "[", "while PROCESSING", "from TOC entry"} {
+		if strings.HasPrefix(message, problem) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,66 @@
+package database
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerboseWriterReportsTablesAndPassesErrors(t *testing.T) {
+	progress := NewProgress()
+	var out strings.Builder
+	w := newVerboseWriter("pg_restore", &out, progress)
+
+	io.WriteString(w, "pg_restore: connecting to database for restore\n")
+	io.WriteString(w, "pg_restore: processing data for table \"public.users\"\npg_restore: processing da")
+	io.WriteString(w, "ta for table \"public.orders\"\n")
+	io.WriteString(w, "pg_restore: while PROCESSING TOC:\npg_restore: error: could not execute query\n")
+
+	state := progress.State()
+	if state.Table != "public.orders" || state.Tables != 1 {
+		t.Errorf("expected public.orders after one table, got %q after %d", state.Table, state.Tables)
+	}
+	want := "pg_restore: while PROCESSING TOC:\npg_restore: error: could not execute query\n"
+	if out.String() != want {
+		t.Errorf("expected only errors passed on, got %q", out.String())
+	}
+}
+
+func TestVerboseTableWithoutQuotes(t *testing.T) {
+	m := verboseTable.FindStringSubmatch("pg_dump: dumping contents of table public.users\n")
+	if m == nil || m[1] != "public.users" {
+		t.Errorf("unexpected match %q", m)
+	}
+}
+
+func TestCopyReaderReportsTables(t *testing.T) {
+	progress := NewProgress()
+	sql := "SET x = 1;\nCOPY public.users (id, name) FROM stdin;\n1\tBob\n\\.\n\nCOPY public.orders (id) FROM stdin;\n\\.\n"
+	r := &countingReader{r: &copyReader{r: strings.NewReader(sql), progress: progress}, progress: progress}
+
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		t.Fatal(err)
+	}
+	state := progress.State()
+	if state.Table != "public.orders" || state.Tables != 1 || state.Bytes != int64(len(sql)) {
+		t.Errorf("unexpected progress %+v", state)
+	}
+}
+
+func TestProgressETA(t *testing.T) {
+	progress := NewProgress()
+	progress.setTotal(1000)
+	progress.started = time.Now().Add(-10 * time.Second)
+	progress.setBytes(250)
+
+	// A quarter took 10 seconds, the rest takes 30 more
+	if eta := progress.State().ETA; eta < 29*time.Second || eta > 31*time.Second {
+		t.Errorf("expected ETA of about 30s, got %v", eta)
+	}
+
+	progress.setBytes(1200)
+	if eta := progress.State().ETA; eta != 0 {
+		t.Errorf("expected unknown ETA past the expected size, got %v", eta)
+	}
+}
@@ -0,0 +1,216 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Command describes a process to run. Arguments are passed to the process
+// as is, without a shell, so they never need quoting.
+type Command struct {
+	Name   string
+	Args   []string
+	Env    []string // added to the environment of the current process
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// String returns the command line for logs. Environment is omitted since it may hold passwords.
+func (c Command) String() string {
+	return strings.Join(append([]string{c.Name}, c.Args...), " ")
+}
+
+// Executor runs a command and waits for it to finish, stopping it when ctx is cancelled.
+// All external tools are started through it, so tests can replace it with a fake.
+type Executor interface {
+	Execute(ctx context.Context, cmd Command) error
+}
+
+// ProcessExecutor runs commands as child processes
+type ProcessExecutor struct{}
+
+// runner runs commands, printing their output to output in debug mode
+type runner struct {
+	exec   Executor
+	debug  bool
+	output io.Writer
+}
+
+// newRunner creates a runner, nil executor runs real processes
+func newRunner(exec Executor, debug bool, output io.Writer) *runner {
+	if exec == nil {
+		exec = ProcessExecutor{}
+	}
+	return &runner{exec: exec, debug: debug, output: output}
+}
+
+// stopTimeout is how long a cancelled tool has to exit before it is killed
+const stopTimeout = 5 * time.Second
+
+// Execute implements Executor. A cancelled command is interrupted first, so that PostgreSQL tools
+// cancel their queries on the server, and killed if it doesn't exit in time.
+func (ProcessExecutor) Execute(ctx context.Context, cmd Command) error {
+	c := exec.CommandContext(ctx, cmd.Name, cmd.Args...)
+	c.Cancel = func() error { return c.Process.Signal(os.Interrupt) }
+	c.WaitDelay = stopTimeout
+	if len(cmd.Env) > 0 {
+		c.Env = append(os.Environ(), cmd.Env...)
+	}
+	c.Stdin = cmd.Stdin
+	c.Stdout = cmd.Stdout
+	c.Stderr = cmd.Stderr
+	return c.Run()
+}
+
+// Run runs the command. Output not redirected by the caller is shown only in debug mode.
+func (r *runner) Run(ctx context.Context, cmd Command) error {
+	if r.debug {
+		debugPrintf(r.output, r.debug, "$ %s\n", cmd)
+		if cmd.Stdout == nil {
+			cmd.Stdout = r.output
+		}
+		if cmd.Stderr == nil {
+			cmd.Stderr = r.output
+		}
+	}
+	return r.exec.Execute(ctx, cmd)
+}
+
+// Output runs the command and returns its stdout. Stderr is included in the returned error.
+func (r *runner) Output(ctx context.Context, cmd Command) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	debugPrintf(r.output, r.debug, "$ %s\n", cmd)
+	if err := r.exec.Execute(ctx, cmd); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return stdout.Bytes(), fmt.Errorf("%w: %s", err, msg)
+		}
+		return stdout.Bytes(), err
+	}
+	return stdout.Bytes(), nil
+}
+
+// pgCommand builds a command for a PostgreSQL client tool connecting to dsn.
+// The password is moved from the DSN to PGPASSWORD so it never appears on the command line;
+// without a password in the DSN libpq falls back to ~/.pgpass.
+func pgCommand(name string, dsn string, args ...string) (Command, error) {
+	dsn, password, ok, err := splitPassword(dsn)
+	if err != nil {
+		return Command{}, fmt.Errorf("error parsing DSN: %w", err)
+	}
+
+	cmd := Command{Name: name}
+	if ok {
+		cmd.Env = append(cmd.Env, "PGPASSWORD="+password)
+	}
+	cmd.Args = append(append([]string{}, args...), "--dbname="+dsn)
+	return cmd, nil
+}
+
+// splitPassword removes the password from dsn, which is either a URI with the password in the user info
+// or the password query parameter, or a "key=value" connection string with the password key
+func splitPassword(dsn string) (string, string, bool, error) {
+	if !strings.HasPrefix(dsn, "postgres://") && !strings.HasPrefix(dsn, "postgresql://") {
+		return splitConninfoPassword(dsn)
+	}
+
+	u, err := url.Parse(dsn)
+	if urlErr := (*url.Error)(nil); errors.As(err, &urlErr) {
+		// The error quotes the URL, which holds the password
+		return "", "", false, urlErr.Err
+	} else if err != nil {
+		return "", "", false, err
+	}
+	password, ok := u.User.Password()
+	if ok {
+		u.User = url.User(u.User.Username())
+	}
+	// Query parameters override the URI components in libpq
+	if query := u.Query(); query.Has("password") {
+		password, ok = query.Get("password"), true
+		query.Del("password")
+		u.RawQuery = query.Encode()
+	}
+	return u.String(), password, ok, nil
+}
+
+// errConninfo doesn't quote the connection string, which may hold the password
+var errConninfo = errors.New("expected \"key=value\" pairs")
+
+// splitConninfoPassword removes the password key from a "key=value" connection string.
+// Values may be single-quoted, backslash escapes quotes and backslashes.
+func splitConninfoPassword(dsn string) (string, string, bool, error) {
+	var password string
+	var ok bool
+	var params []string
+
+	rest := strings.TrimSpace(dsn)
+	for rest != "" {
+		eq := strings.IndexByte(rest, '=')
+		if eq <= 0 {
+			return "", "", false, errConninfo
+		}
+		key := strings.TrimSpace(rest[:eq])
+		if strings.ContainsAny(key, " \t\n") {
+			return "", "", false, errConninfo
+		}
+
+		value, next, err := conninfoValue(strings.TrimLeft(rest[eq+1:], " \t\n"))
+		if err != nil {
+			return "", "", false, fmt.Errorf("invalid value of %s: %w", key, err)
+		}
+		rest = strings.TrimLeft(next, " \t\n")
+
+		if key == "password" {
+			password, ok = value, true
+			continue
+		}
+		params = append(params, key+"="+quoteConninfo(value))
+	}
+	return strings.Join(params, " "), password, ok, nil
+}
+
+// conninfoValue reads a single-quoted or unquoted value from the start of s and returns the rest
+func conninfoValue(s string) (string, string, error) {
+	var value strings.Builder
+	quoted := strings.HasPrefix(s, "'")
+	if quoted {
+		s = s[1:]
+	}
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\' && i+1 < len(s):
+			i++
+			value.WriteByte(s[i])
+		case quoted && c == '\'':
+			return value.String(), s[i+1:], nil
+		case !quoted && (c == ' ' || c == '\t' || c == '\n'):
+			return value.String(), s[i:], nil
+		default:
+			value.WriteByte(c)
+		}
+	}
+	if quoted {
+		return "", "", fmt.Errorf("unterminated quoted string")
+	}
+	return value.String(), "", nil
+}
+
+// quoteConninfo quotes a connection string value when it is empty or contains special characters
+func quoteConninfo(value string) string {
+	if value != "" && !strings.ContainsAny(value, " \t\n'\\") {
+		return value
+	}
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
@@ -0,0 +1,320 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Subset selects rows reachable from root table rows matching a condition
+type Subset struct {
+	Table string // root table, optionally schema-qualified
+	Where string // SQL condition selecting root rows
+}
+
+// subsetPattern matches subset definition like "tenants where id = 42"
+var subsetPattern = regexp.MustCompile(`(?is)^\s*(\S+)\s+where\s+(.+?)\s*$`)
+
+// ParseSubset parses subset definition in the form "<table> where <condition>"
+func ParseSubset(definition string) (*Subset, error) {
+	match := subsetPattern.FindStringSubmatch(definition)
+	if match == nil {
+		return nil, fmt.Errorf("invalid subset %q: expected \"<table> where <condition>\"", definition)
+	}
+	return &Subset{Table: match[1], Where: match[2]}, nil
+}
+
+// String returns subset definition
+func (s Subset) String() string {
+	return fmt.Sprintf("%s where %s", s.Table, s.Where)
+}
+
+// checkSubset rejects options subset dumps don't support, before anything runs
+func checkSubset(opts DumpOptions) error {
+	if opts.Subset == nil {
+		return nil
+	}
+	if opts.Format != "" && opts.Format != FormatPlain {
+		return fmt.Errorf("subset dumps are only supported for plain format")
+	}
+	if len(opts.IncludeTables) > 0 || len(opts.ExcludeTables) > 0 || len(opts.ExcludeTableData) > 0 {
+		return fmt.Errorf("subset dumps can't be combined with table filters")
+	}
+	return nil
+}
+
+// foreignKey is a foreign key between two tables, names are quoted and schema-qualified
+type foreignKey struct {
+	child      string
+	childCols  string
+	parent     string
+	parentCols string
+}
+
+// writeSubset writes plain SQL dump with the full schema and only the rows reachable
+// from subset root: rows referencing selected rows (following foreign keys down)
+// and rows referenced by them (following foreign keys up)
+func writeSubset(ctx context.Context, r *runner, dsn string, w io.Writer, opts DumpOptions) error {
+	schemas := schemasOrDefault(opts.Schemas)
+
+	root, err := queryRows(ctx, r, dsn, fmt.Sprintf(
+		"SELECT quote_ident(n.nspname) || '.' || quote_ident(c.relname) "+
+			"FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace "+
+			"WHERE c.oid = to_regclass(%s)", quoteLiteral(opts.Subset.Table)))
+	if err != nil {
+		return fmt.Errorf("error looking up subset root table: %w", err)
+	}
+	if len(root) == 0 {
+		return fmt.Errorf("subset root table not found: %s", opts.Subset.Table)
+	}
+
+	keys, err := queryForeignKeys(ctx, r, dsn, schemas)
+	if err != nil {
+		return err
+	}
+
+	plan := planSubset(root[0][0], keys)
+	debugPrintf(opts.Output, opts.Debug, "Subset includes %d tables\n", len(plan.tables))
+
+	columns, err := queryRows(ctx, r, dsn, fmt.Sprintf(
+		"SELECT quote_ident(n.nspname) || '.' || quote_ident(c.relname), "+
+			"string_agg(quote_ident(a.attname), ', ' ORDER BY a.attnum) "+
+			"FROM pg_attribute a JOIN pg_class c ON c.oid = a.attrelid "+
+			"JOIN pg_namespace n ON n.oid = c.relnamespace "+
+			"WHERE c.relkind IN ('r', 'p') AND a.attnum > 0 AND NOT a.attisdropped AND a.attgenerated = '' "+
+			"AND n.nspname IN (%s) GROUP BY 1", quoteList(schemas)))
+	if err != nil {
+		return fmt.Errorf("error reading table columns: %w", err)
+	}
+	tableColumns := make(map[string]string)
+	for _, row := range columns {
+		tableColumns[row[0]] = row[1]
+	}
+
+	// Like pg_dump, tables are created before the data and constraints, indexes and triggers
+	// after it, so rows load in any order without disabling foreign keys, which needs a superuser
+	if err := dumpSchemaSection(ctx, r, dsn, w, schemas, "pre-data"); err != nil {
+		return err
+	}
+
+	// Rows are selected into temporary tables, which only live in one session,
+	// so the selection and the COPY of every table run as a single psql script
+	fmt.Fprintln(w)
+	script := subsetScript(plan, root[0][0], opts.Subset.Where, tableColumns)
+	dataCmd, err := pgCommand("psql", dsn, "-X", "-q", "-A", "-t", "-v", "ON_ERROR_STOP=1")
+	if err != nil {
+		return err
+	}
+	dataCmd.Stdin = strings.NewReader(script)
+	dataCmd.Stdout = w
+	if err := r.Run(ctx, dataCmd); err != nil {
+		return fmt.Errorf("error dumping subset data: %w", err)
+	}
+	fmt.Fprintln(w)
+
+	// Move sequences past the loaded rows
+	sequences, err := queryRows(ctx, r, dsn, fmt.Sprintf(
+		"SELECT quote_ident(sn.nspname) || '.' || quote_ident(s.relname), "+
+			"quote_ident(tn.nspname) || '.' || quote_ident(t.relname), quote_ident(a.attname) "+
+			"FROM pg_depend d "+
+			"JOIN pg_class s ON s.oid = d.objid AND s.relkind = 'S' "+
+			"JOIN pg_namespace sn ON sn.oid = s.relnamespace "+
+			"JOIN pg_class t ON t.oid = d.refobjid "+
+			"JOIN pg_namespace tn ON tn.oid = t.relnamespace "+
+			"JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = d.refobjsubid "+
+			"WHERE d.classid = 'pg_class'::regclass AND d.deptype IN ('a', 'i') AND tn.nspname IN (%s)",
+		quoteList(schemas)))
+	if err != nil {
+		return fmt.Errorf("error reading sequences: %w", err)
+	}
+	for _, row := range sequences {
+		fmt.Fprintf(w, "SELECT pg_catalog.setval(%s, COALESCE((SELECT max(%s) FROM %s), 0) + 1, false);\n",
+			quoteLiteral(row[0]), row[2], row[1])
+	}
+
+	return dumpSchemaSection(ctx, r, dsn, w, schemas, "post-data")
+}
+
+// dumpSchemaSection writes a pg_dump section of the schemas, pre-data or post-data.
+// Objects are dropped first only in pre-data, subset dumps are loaded into a recreated database.
+func dumpSchemaSection(ctx context.Context, r *runner, dsn string, w io.Writer, schemas []string, section string) error {
+	args := []string{"--section=" + section, "--no-owner", "--no-privileges"}
+	if section == "pre-data" {
+		args = append(args, "--clean", "--if-exists")
+	}
+	for _, schema := range schemas {
+		args = append(args, "--schema="+schema)
+	}
+	cmd, err := pgCommand("pg_dump", dsn, args...)
+	if err != nil {
+		return err
+	}
+	cmd.Stdout = w
+	if err := r.Run(ctx, cmd); err != nil {
+		return fmt.Errorf("error dumping schema %s: %w", section, err)
+	}
+	return nil
+}
+
+// subsetPlan describes which tables and foreign keys a subset dump follows
+type subsetPlan struct {
+	tables []string     // tables rows may be selected from, sorted
+	down   []foreignKey // keys followed from selected rows to rows referencing them
+	up     []foreignKey // keys followed from selected rows to rows they reference
+}
+
+// planSubset returns tables reachable from root and the foreign keys leading to them.
+// Keys are followed down from root to referencing tables, including self-references,
+// but never back into root, so root rows are only added to keep foreign keys valid.
+// Then every key of a reachable table is followed up to the rows it references.
+func planSubset(root string, keys []foreignKey) subsetPlan {
+	var plan subsetPlan
+
+	reached := map[string]bool{root: true}
+	for changed := true; changed; {
+		changed = false
+		for _, fk := range keys {
+			if reached[fk.parent] && !reached[fk.child] && fk.child != root {
+				reached[fk.child] = true
+				changed = true
+			}
+		}
+	}
+	for _, fk := range keys {
+		if reached[fk.parent] && fk.child != root {
+			plan.down = append(plan.down, fk)
+		}
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for _, fk := range keys {
+			if reached[fk.child] && !reached[fk.parent] {
+				reached[fk.parent] = true
+				changed = true
+			}
+		}
+	}
+	for _, fk := range keys {
+		if reached[fk.child] {
+			plan.up = append(plan.up, fk)
+		}
+	}
+
+	for table := range reached {
+		plan.tables = append(plan.tables, table)
+	}
+	sort.Strings(plan.tables)
+	return plan
+}
+
+// subsetScript returns psql script writing COPY blocks of the subset rows. Selected rows of each
+// table are kept in a temporary table and foreign keys are followed until no key adds a row,
+// first down and then up, so the size of the queries doesn't depend on the depth of the schema.
+// Rows are identified by tableoid and ctid, which are stable within the transaction snapshot.
+func subsetScript(plan subsetPlan, root string, where string, columns map[string]string) string {
+	selected := make(map[string]string, len(plan.tables))
+	script := &strings.Builder{}
+	fmt.Fprintln(script, "SET standard_conforming_strings = on;")
+	fmt.Fprintln(script, "BEGIN ISOLATION LEVEL REPEATABLE READ;")
+	for i, table := range plan.tables {
+		selected[table] = fmt.Sprintf("subset_%d", i)
+		fmt.Fprintf(script, "CREATE TEMPORARY TABLE %s (tbl oid, row_id tid, PRIMARY KEY (tbl, row_id)) ON COMMIT DROP;\n",
+			selected[table])
+	}
+	fmt.Fprintf(script, "INSERT INTO %s SELECT tableoid, ctid FROM %s WHERE (%s);\n", selected[root], root, where)
+
+	// follow inserts rows of table matching cols to the source columns of selected source rows
+	follow := func(table, cols, source, sourceCols string) string {
+		return fmt.Sprintf("INSERT INTO %s SELECT tableoid, ctid FROM %s WHERE (%s) IN "+
+			"(SELECT %s FROM %s WHERE (tableoid, ctid) IN (SELECT tbl, row_id FROM %s)) ON CONFLICT DO NOTHING;",
+			selected[table], table, cols, sourceCols, source, selected[source])
+	}
+	var down, up []string
+	for _, fk := range plan.down {
+		down = append(down, follow(fk.child, fk.childCols, fk.parent, fk.parentCols))
+	}
+	for _, fk := range plan.up {
+		up = append(up, follow(fk.parent, fk.parentCols, fk.child, fk.childCols))
+	}
+	if len(down) > 0 || len(up) > 0 {
+		fmt.Fprintln(script, "DO $subset$\nDECLARE\n\tadded bigint;\n\ttotal bigint;\nBEGIN")
+		for _, statements := range [][]string{down, up} {
+			if len(statements) == 0 {
+				continue
+			}
+			fmt.Fprintln(script, "\tLOOP\n\t\ttotal := 0;")
+			for _, statement := range statements {
+				fmt.Fprintf(script, "\t\t%s\n\t\tGET DIAGNOSTICS added = ROW_COUNT;\n\t\ttotal := total + added;\n", statement)
+			}
+			fmt.Fprintln(script, "\t\tEXIT WHEN total = 0;\n\tEND LOOP;")
+		}
+		fmt.Fprintln(script, "END\n$subset$;")
+	}
+
+	// Unaligned tuples-only output prints COPY headers and terminators as they are
+	for _, table := range plan.tables {
+		cols, ok := columns[table]
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(script, "SELECT %s;\n", quoteLiteral(fmt.Sprintf("COPY %s (%s) FROM stdin;", table, cols)))
+		fmt.Fprintf(script, "COPY (SELECT %s FROM %s WHERE (tableoid, ctid) IN (SELECT tbl, row_id FROM %s)) TO STDOUT;\n",
+			cols, table, selected[table])
+		fmt.Fprintln(script, `SELECT '\.';`)
+	}
+	fmt.Fprintln(script, "COMMIT;")
+	return script.String()
+}
+
+// queryForeignKeys returns foreign keys between tables of the schemas
+func queryForeignKeys(ctx context.Context, r *runner, dsn string, schemas []string) ([]foreignKey, error) {
+	columnList := func(key, rel string) string {
+		return fmt.Sprintf("(SELECT string_agg(quote_ident(a.attname), ', ' ORDER BY k.ord) "+
+			"FROM unnest(con.%s) WITH ORDINALITY k(attnum, ord) "+
+			"JOIN pg_attribute a ON a.attrelid = con.%s AND a.attnum = k.attnum)", key, rel)
+	}
+
+	rows, err := queryRows(ctx, r, dsn, fmt.Sprintf(
+		"SELECT quote_ident(cn.nspname) || '.' || quote_ident(c.relname), %s, "+
+			"quote_ident(pn.nspname) || '.' || quote_ident(p.relname), %s "+
+			"FROM pg_constraint con "+
+			"JOIN pg_class c ON c.oid = con.conrelid JOIN pg_namespace cn ON cn.oid = c.relnamespace "+
+			"JOIN pg_class p ON p.oid = con.confrelid JOIN pg_namespace pn ON pn.oid = p.relnamespace "+
+			"WHERE con.contype = 'f' AND cn.nspname IN (%s) AND pn.nspname IN (%s) ORDER BY 1, 3, con.conname",
+		columnList("conkey", "conrelid"), columnList("confkey", "confrelid"),
+		quoteList(schemas), quoteList(schemas)))
+	if err != nil {
+		return nil, fmt.Errorf("error reading foreign keys: %w", err)
+	}
+
+	keys := make([]foreignKey, 0, len(rows))
+	for _, row := range rows {
+		keys = append(keys, foreignKey{child: row[0], childCols: row[1], parent: row[2], parentCols: row[3]})
+	}
+	return keys, nil
+}
+
+// queryRows runs query with psql and returns tab separated columns of each row
+func queryRows(ctx context.Context, r *runner, dsn string, query string) ([][]string, error) {
+	cmd, err := pgCommand("psql", dsn, "-X", "-A", "-t", "-F", "\t", "-v", "ON_ERROR_STOP=1", "-c", query)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := r.Output(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows [][]string
+	for _, line := range strings.Split(strings.TrimRight(string(output), "\n"), "\n") {
+		if line != "" {
+			rows = append(rows, strings.Split(line, "\t"))
+		}
+	}
+	return rows, nil
+}
@@ -0,0 +1,137 @@
+package database
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func key(child, childCols, parent, parentCols string) foreignKey {
+	return foreignKey{child: child, childCols: childCols, parent: parent, parentCols: parentCols}
+}
+
+func TestPlanSubset(t *testing.T) {
+	var (
+		usersTenant    = key("public.users", "tenant_id", "public.tenants", "id")
+		ordersUser     = key("public.orders", "user_id", "public.users", "id")
+		ordersProduct  = key("public.orders", "product_id", "public.products", "id")
+		projectsTenant = key("public.projects", "tenant_id", "public.tenants", "id")
+		tasksProject   = key("public.tasks", "project_id", "public.projects", "id")
+		tasksUser      = key("public.tasks", "assignee_id", "public.users", "id")
+		usersManager   = key("public.users", "manager_id", "public.users", "id")
+		tenantsParent  = key("public.tenants", "parent_id", "public.tenants", "id")
+		usersCountry   = key("public.users", "country", "public.countries", "code")
+	)
+
+	tests := []struct {
+		name   string
+		keys   []foreignKey
+		tables []string
+		down   []foreignKey
+		up     []foreignKey
+	}{
+		{
+			name:   "chain",
+			keys:   []foreignKey{ordersProduct, ordersUser, usersTenant},
+			tables: []string{"public.orders", "public.products", "public.tenants", "public.users"},
+			down:   []foreignKey{ordersUser, usersTenant},
+			up:     []foreignKey{ordersProduct, ordersUser, usersTenant},
+		},
+		{
+			name:   "diamond",
+			keys:   []foreignKey{projectsTenant, tasksProject, tasksUser, usersTenant},
+			tables: []string{"public.projects", "public.tasks", "public.tenants", "public.users"},
+			down:   []foreignKey{projectsTenant, tasksProject, tasksUser, usersTenant},
+			up:     []foreignKey{projectsTenant, tasksProject, tasksUser, usersTenant},
+		},
+		{
+			name:   "self reference",
+			keys:   []foreignKey{tenantsParent, usersCountry, usersManager, usersTenant},
+			tables: []string{"public.countries", "public.tenants", "public.users"},
+			down:   []foreignKey{usersManager, usersTenant},
+			up:     []foreignKey{tenantsParent, usersCountry, usersManager, usersTenant},
+		},
+		{
+			name:   "unrelated tables",
+			keys:   []foreignKey{ordersProduct},
+			tables: []string{"public.tenants"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := planSubset("public.tenants", tt.keys)
+			if !reflect.DeepEqual(plan.tables, tt.tables) {
+				t.Errorf("tables = %q, want %q", plan.tables, tt.tables)
+			}
+			if !reflect.DeepEqual(plan.down, tt.down) {
+				t.Errorf("down = %v, want %v", plan.down, tt.down)
+			}
+			if !reflect.DeepEqual(plan.up, tt.up) {
+				t.Errorf("up = %v, want %v", plan.up, tt.up)
+			}
+		})
+	}
+}
+
+func TestSubsetScriptFollowsEveryKeyOnce(t *testing.T) {
+	// Diamond: tasks reference both projects and users of the tenant
+	keys := []foreignKey{
+		key("public.projects", "tenant_id", "public.tenants", "id"),
+		key("public.tasks", "project_id", "public.projects", "id"),
+		key("public.tasks", "assignee_id", "public.users", "id"),
+		key("public.users", "tenant_id", "public.tenants", "id"),
+	}
+	plan := planSubset("public.tenants", keys)
+	columns := map[string]string{
+		"public.projects": "id, tenant_id",
+		"public.tasks":    "id, project_id, assignee_id",
+		"public.tenants":  "id",
+		"public.users":    "id, tenant_id",
+	}
+	script := subsetScript(plan, "public.tenants", "id = 42", columns)
+
+	inserts := strings.Count(script, "INSERT INTO")
+	if want := 1 + len(plan.down) + len(plan.up); inserts != want {
+		t.Errorf("expected %d inserts, got %d:\n%s", want, inserts, script)
+	}
+	for _, line := range strings.Split(script, "\n") {
+		if strings.Count(line, "SELECT tbl, row_id") > 1 {
+			t.Errorf("selected rows must not be nested: %s", line)
+		}
+	}
+	if !strings.Contains(script, "INSERT INTO subset_2 SELECT tableoid, ctid FROM public.tenants WHERE (id = 42);") {
+		t.Errorf("root rows not selected:\n%s", script)
+	}
+	want := "INSERT INTO subset_1 SELECT tableoid, ctid FROM public.tasks WHERE (assignee_id) IN " +
+		"(SELECT id FROM public.users WHERE (tableoid, ctid) IN (SELECT tbl, row_id FROM subset_3)) ON CONFLICT DO NOTHING;"
+	if !strings.Contains(script, want) {
+		t.Errorf("tasks of selected users not followed:\n%s", script)
+	}
+	if script != subsetScript(planSubset("public.tenants", keys), "public.tenants", "id = 42", columns) {
+		t.Error("script must not depend on map order")
+	}
+
+	copyBlock := "SELECT 'COPY public.tasks (id, project_id, assignee_id) FROM stdin;';\n" +
+		"COPY (SELECT id, project_id, assignee_id FROM public.tasks WHERE (tableoid, ctid) IN " +
+		"(SELECT tbl, row_id FROM subset_1)) TO STDOUT;\n" +
+		"SELECT '\\.';\n"
+	if !strings.Contains(script, copyBlock) {
+		t.Errorf("COPY block of tasks missing:\n%s", script)
+	}
+}
+
+func TestSubsetScriptFollowsSelfReferenceUp(t *testing.T) {
+	keys := []foreignKey{key("public.tenants", "parent_id", "public.tenants", "id")}
+	script := subsetScript(planSubset("public.tenants", keys), "public.tenants", "id = 42", map[string]string{
+		"public.tenants": "id, parent_id",
+	})
+
+	want := "INSERT INTO subset_0 SELECT tableoid, ctid FROM public.tenants WHERE (id) IN " +
+		"(SELECT parent_id FROM public.tenants WHERE (tableoid, ctid) IN (SELECT tbl, row_id FROM subset_0)) ON CONFLICT DO NOTHING;"
+	if !strings.Contains(script, want) {
+		t.Errorf("parents of selected tenants not followed:\n%s", script)
+	}
+	if !strings.Contains(script, "EXIT WHEN total = 0;") {
+		t.Errorf("keys must be followed until no rows are added:\n%s", script)
+	}
+}
@@ -0,0 +1,111 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Version is a PostgreSQL version in server_version_num form, e.g. 160002 for 16.2
+// or 90624 for 9.6.24. Zero version means unknown.
+type Version int
+
+// versionPattern matches version numbers like "16.2", "9.6.24" or "17beta1"
+var versionPattern = regexp.MustCompile(`(\d+)(?:\.(\d+))?(?:\.(\d+))?`)
+
+// ParseVersion parses a version like "16.2" or "9.6.24"
+func ParseVersion(s string) (Version, error) {
+	match := versionPattern.FindStringSubmatch(s)
+	if match == nil {
+		return 0, fmt.Errorf("invalid PostgreSQL version %q", s)
+	}
+
+	parts := make([]int, 3)
+	for i := range parts {
+		if match[i+1] != "" {
+			parts[i], _ = strconv.Atoi(match[i+1])
+		}
+	}
+
+	// Since 10 versions have two parts, before it the major version had two
+	if parts[0] >= 10 {
+		return Version(parts[0]*10000 + parts[1]), nil
+	}
+	return Version(parts[0]*10000 + parts[1]*100 + parts[2]), nil
+}
+
+// Major returns the major version, e.g. "16" or "9.6"
+func (v Version) Major() string {
+	if v >= 100000 {
+		return strconv.Itoa(int(v) / 10000)
+	}
+	return fmt.Sprintf("%d.%d", v/10000, v/100%100)
+}
+
+// String returns the version, e.g. "16.2" or "9.6.24"
+func (v Version) String() string {
+	if v == 0 {
+		return ""
+	}
+	if v >= 100000 {
+		return fmt.Sprintf("%d.%d", v/10000, v%10000)
+	}
+	return fmt.Sprintf("%d.%d.%d", v/10000, v/100%100, v%100)
+}
+
+// OlderMajor reports whether the major version of v is older than of other
+func (v Version) OlderMajor(other Version) bool {
+	return v.majorNum() < other.majorNum()
+}
+
+func (v Version) majorNum() int {
+	if v >= 100000 {
+		return int(v) / 10000 * 10000
+	}
+	return int(v) / 100 * 100
+}
+
+// ImageForVersion returns the image with its tag replaced by the major version, e.g. postgres:13
+func ImageForVersion(image string, v Version) string {
+	i := strings.LastIndex(image, ":")
+	if i >= 0 && !strings.Contains(image[i:], "/") {
+		image = image[:i]
+	}
+	return image + ":" + v.Major()
+}
+
+// queryServerVersion returns version of the server at dsn
+func queryServerVersion(ctx context.Context, r *runner, dsn string) (Version, error) {
+	rows, err := queryRows(ctx, r, dsn, "SHOW server_version_num")
+	if err != nil {
+		return 0, err
+	}
+	if len(rows) == 0 {
+		return 0, fmt.Errorf("server version not returned")
+	}
+	return parseVersionNum(rows[0][0])
+}
+
+func parseVersionNum(s string) (Version, error) {
+	num, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid server version %q", s)
+	}
+	return Version(num), nil
+}
+
+// pgDumpVersion returns version of the local pg_dump, reported like "pg_dump (PostgreSQL) 16.2"
+func pgDumpVersion(ctx context.Context, r *runner) (Version, error) {
+	output, err := r.Output(ctx, Command{Name: "pg_dump", Args: []string{"--version"}})
+	if err != nil {
+		return 0, err
+	}
+
+	line := string(output)
+	if i := strings.Index(line, ")"); i >= 0 {
+		line = line[i+1:]
+	}
+	return ParseVersion(line)
+}
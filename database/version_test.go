@@ -0,0 +1,50 @@
+package database
+
+import "testing"
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		in    string
+		num   Version
+		major string
+	}{
+		{"16.2", 160002, "16"},
+		{"13", 130000, "13"},
+		{"9.6.24", 90624, "9.6"},
+		{"17beta1", 170000, "17"},
+	}
+	for _, tt := range tests {
+		v, err := ParseVersion(tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != tt.num || v.Major() != tt.major {
+			t.Errorf("ParseVersion(%q) = %d (major %s), want %d (major %s)", tt.in, v, v.Major(), tt.num, tt.major)
+		}
+	}
+}
+
+func TestVersionOlderMajor(t *testing.T) {
+	if Version(160009).OlderMajor(160002) {
+		t.Error("minor versions of the same major are compatible")
+	}
+	if !Version(90624).OlderMajor(100000) {
+		t.Error("9.6 is older than 10")
+	}
+	if !Version(90500).OlderMajor(90624) {
+		t.Error("9.5 is older than 9.6")
+	}
+}
+
+func TestImageForVersion(t *testing.T) {
+	tests := map[string]string{
+		"postgres:16":                 "postgres:13",
+		"postgres":                    "postgres:13",
+		"registry:5000/team/postgres": "registry:5000/team/postgres:13",
+	}
+	for image, want := range tests {
+		if got := ImageForVersion(image, 130011); got != want {
+			t.Errorf("ImageForVersion(%q) = %q, want %q", image, got, want)
+		}
+	}
+}
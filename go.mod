@@ -3,14 +3,18 @@ module dumper
 go 1.23.5
 
 require (
-	github.com/jroimartin/gocui v0.5.0 // indirect
-	github.com/lib/pq v1.10.9 // indirect
+	github.com/jroimartin/gocui v0.5.0
+	github.com/klauspost/compress v1.18.0
+	github.com/lib/pq v1.10.9
+	github.com/pressly/goose/v3 v3.24.1
+	gopkg.in/yaml.v2 v2.4.0
+)
+
+require (
 	github.com/mattn/go-runewidth v0.0.9 // indirect
 	github.com/mfridman/interpolate v0.0.2 // indirect
 	github.com/nsf/termbox-go v1.1.1 // indirect
-	github.com/pressly/goose/v3 v3.24.1 // indirect
 	github.com/sethvargo/go-retry v0.3.0 // indirect
 	go.uber.org/multierr v1.11.0 // indirect
 	golang.org/x/sync v0.10.0 // indirect
-	gopkg.in/yaml.v2 v2.4.0 // indirect
 )
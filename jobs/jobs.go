@@ -0,0 +1,310 @@
+// Package jobs runs dumps, loads, migrations and other long operations in the background.
+// Jobs of one environment run one after another, and so do jobs working on one local server,
+// e.g. loads of several environments into the shared container. Other jobs run at once.
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"dumper/database"
+)
+
+// State of a job
+type State string
+
+const (
+	StateQueued  State = "queued"
+	StateRunning State = "running"
+	StateDone    State = "done"
+	StateFailed  State = "failed"
+)
+
+// Func is the operation run by a job. It stops when ctx is cancelled.
+type Func func(ctx context.Context, job *Job) error
+
+// Job is an operation added to the queue
+type Job struct {
+	ID   int
+	Name string // what the job does, e.g. "load stage"
+	Env  string // environment the job works on
+	// Target is the local server the job works on, empty if it doesn't use one
+	Target string
+
+	run           Func
+	trackProgress bool
+	onLog         func(format string, args ...interface{})
+	ctx           context.Context
+	cancel        context.CancelFunc
+
+	mu       sync.Mutex
+	progress *database.Progress
+	state    State
+	err      error
+	logs     []string
+	started  time.Time
+	finished time.Time
+}
+
+// Logf adds a message to the job's log
+func (j *Job) Logf(format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+
+	j.mu.Lock()
+	j.logs = append(j.logs, message)
+	j.mu.Unlock()
+
+	if j.onLog != nil {
+		j.onLog("%s", message)
+	}
+}
+
+// State returns the current state of the job
+func (j *Job) State() State {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.state
+}
+
+// Progress returns progress of a running or finished dump or load, nil for other jobs
+func (j *Job) Progress() *database.Progress {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.progress
+}
+
+// Err returns the error a failed job finished with
+func (j *Job) Err() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.err
+}
+
+// Logs returns messages logged by the job
+func (j *Job) Logs() []string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return append([]string(nil), j.logs...)
+}
+
+// Duration returns how long the job has been running or ran, 0 while it is queued
+func (j *Job) Duration() time.Duration {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	switch {
+	case j.started.IsZero():
+		return 0
+	case j.finished.IsZero():
+		return time.Since(j.started)
+	default:
+		return j.finished.Sub(j.started)
+	}
+}
+
+// Finished reports whether the job is done or failed
+func (j *Job) Finished() bool {
+	state := j.State()
+	return state == StateDone || state == StateFailed
+}
+
+// Queue runs added jobs in the background
+type Queue struct {
+	mu       sync.Mutex
+	jobs     []*Job
+	nextID   int
+	onLog    func(format string, args ...interface{})
+	onChange func(job *Job)
+	wg       sync.WaitGroup
+}
+
+// NewQueue creates an empty queue. Messages logged by jobs are passed on to onLog,
+// onChange is called when a job changes state. Both are called from the jobs' goroutines.
+func NewQueue(onLog func(format string, args ...interface{}), onChange func(job *Job)) *Queue {
+	return &Queue{nextID: 1, onLog: onLog, onChange: onChange}
+}
+
+// Add queues the job, it starts when no earlier job of the environment or the target is unfinished.
+// With trackProgress the job gets a progress when it starts, e.g. for a dump or load.
+func (q *Queue) Add(name string, env string, target string, trackProgress bool, run Func) *Job {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	q.mu.Lock()
+	job := &Job{
+		ID:            q.nextID,
+		Name:          name,
+		Env:           env,
+		Target:        target,
+		run:           run,
+		trackProgress: trackProgress,
+		onLog:         q.onLog,
+		ctx:           ctx,
+		cancel:        cancel,
+		state:         StateQueued,
+	}
+	q.nextID++
+	q.jobs = append(q.jobs, job)
+	q.mu.Unlock()
+
+	q.changed(job)
+	q.schedule()
+	return job
+}
+
+// Jobs returns all jobs in the order they were added
+func (q *Queue) Jobs() []*Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]*Job(nil), q.jobs...)
+}
+
+// Running returns running jobs of the environment, or of all environments if env is empty
+func (q *Queue) Running(env string) []*Job {
+	var running []*Job
+	for _, job := range q.Jobs() {
+		if job.State() == StateRunning && (env == "" || job.Env == env) {
+			running = append(running, job)
+		}
+	}
+	return running
+}
+
+// Cancel stops a running job or fails a queued one, it reports false if the job has finished
+func (q *Queue) Cancel(job *Job) bool {
+	job.mu.Lock()
+	state := job.state
+	if state == StateQueued {
+		job.state = StateFailed
+		job.err = fmt.Errorf("cancelled")
+	}
+	job.mu.Unlock()
+
+	switch state {
+	case StateQueued:
+		job.cancel()
+		job.Logf("Job %s cancelled before it started", job.Name)
+		q.changed(job)
+		return true
+	case StateRunning:
+		job.cancel()
+		return true
+	default:
+		return false
+	}
+}
+
+// CancelAll cancels all unfinished jobs, e.g. on quit, and returns the ones that were running.
+// Queued jobs don't get a chance to start meanwhile.
+func (q *Queue) CancelAll() []*Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var running []*Job
+	for _, job := range q.jobs {
+		if job.State() == StateRunning {
+			running = append(running, job)
+		}
+		q.Cancel(job)
+	}
+	return running
+}
+
+// ClearFinished removes done and failed jobs from the queue
+func (q *Queue) ClearFinished() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	jobs := q.jobs[:0]
+	for _, job := range q.jobs {
+		if !job.Finished() {
+			jobs = append(jobs, job)
+		}
+	}
+	q.jobs = jobs
+}
+
+// Wait waits until all started jobs finish
+func (q *Queue) Wait() {
+	q.wg.Wait()
+}
+
+// schedule starts queued jobs whose environment and target are not used by an earlier
+// running or queued job, so jobs sharing either start in the order they were added
+func (q *Queue) schedule() {
+	q.mu.Lock()
+	busy := make(map[string]bool)
+	var start []*Job
+	for _, job := range q.jobs {
+		keys := job.keys()
+		job.mu.Lock()
+		switch job.state {
+		case StateRunning:
+			for _, key := range keys {
+				busy[key] = true
+			}
+		case StateQueued:
+			free := true
+			for _, key := range keys {
+				free = free && !busy[key]
+				busy[key] = true
+			}
+			if free {
+				job.state = StateRunning
+				job.started = time.Now()
+				if job.trackProgress {
+					job.progress = database.NewProgress()
+				}
+				start = append(start, job)
+				q.wg.Add(1)
+			}
+		}
+		job.mu.Unlock()
+	}
+	q.mu.Unlock()
+
+	for _, job := range start {
+		q.changed(job)
+		go q.runJob(job)
+	}
+}
+
+// keys returns what the job has to use alone
+func (j *Job) keys() []string {
+	keys := []string{"env " + j.Env}
+	if j.Target != "" {
+		keys = append(keys, "target "+j.Target)
+	}
+	return keys
+}
+
+func (q *Queue) runJob(job *Job) {
+	defer q.wg.Done()
+
+	err := job.run(job.ctx, job)
+	job.cancel()
+
+	job.mu.Lock()
+	job.finished = time.Now()
+	job.err = err
+	job.state = StateDone
+	if err != nil {
+		job.state = StateFailed
+	}
+	job.mu.Unlock()
+
+	if err != nil {
+		job.Logf("Job %s failed after %s: %v", job.Name, job.Duration().Round(time.Second), err)
+	} else {
+		job.Logf("Job %s done in %s", job.Name, job.Duration().Round(time.Second))
+	}
+	q.changed(job)
+	q.schedule()
+}
+
+func (q *Queue) changed(job *Job) {
+	if q.onChange != nil {
+		q.onChange(job)
+	}
+}
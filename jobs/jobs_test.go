@@ -0,0 +1,172 @@
+package jobs_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"dumper/jobs"
+)
+
+// blocking returns a job function that runs until release is closed or the job is cancelled
+func blocking(started chan<- string, release <-chan struct{}, name string) jobs.Func {
+	return func(ctx context.Context, job *jobs.Job) error {
+		started <- name
+		select {
+		case <-release:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func expectStarted(t *testing.T, started <-chan string, want string) {
+	t.Helper()
+	select {
+	case name := <-started:
+		if name != want {
+			t.Fatalf("expected %s to start, got %s", want, name)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("%s not started", want)
+	}
+}
+
+func TestJobsOfOneEnvironmentRunInOrder(t *testing.T) {
+	queue := jobs.NewQueue(nil, nil)
+	started := make(chan string, 3)
+	release := make(chan struct{})
+
+	dump := queue.Add("dump stage", "stage", "", false, blocking(started, release, "dump"))
+	load := queue.Add("load stage", "stage", "", false, blocking(started, release, "load"))
+	other := queue.Add("dump dev", "dev", "", false, blocking(started, release, "other"))
+
+	// The job of another environment doesn't wait
+	first, second := <-started, <-started
+	if !(first == "dump" && second == "other" || first == "other" && second == "dump") {
+		t.Fatalf("expected dump and other to start, got %s and %s", first, second)
+	}
+	if load.State() != jobs.StateQueued {
+		t.Errorf("load must wait for dump of the same environment, got %s", load.State())
+	}
+
+	close(release)
+	expectStarted(t, started, "load")
+	queue.Wait()
+
+	for _, job := range []*jobs.Job{dump, load, other} {
+		if job.State() != jobs.StateDone {
+			t.Errorf("expected %s done, got %s", job.Name, job.State())
+		}
+	}
+}
+
+func TestJobsOfOneTargetRunInOrder(t *testing.T) {
+	queue := jobs.NewQueue(nil, nil)
+	started := make(chan string, 3)
+	release := make(chan struct{})
+
+	// Both environments load into the shared container, the dump doesn't use it
+	stage := queue.Add("load stage", "stage", "container local_postgres", false, blocking(started, release, "stage"))
+	dev := queue.Add("load dev", "dev", "container local_postgres", false, blocking(started, release, "dev"))
+	dump := queue.Add("dump qa", "qa", "", false, blocking(started, release, "dump"))
+
+	first, second := <-started, <-started
+	if !(first == "stage" && second == "dump" || first == "dump" && second == "stage") {
+		t.Fatalf("expected stage and dump to start, got %s and %s", first, second)
+	}
+	if dev.State() != jobs.StateQueued {
+		t.Errorf("load dev must wait for load stage into the same container, got %s", dev.State())
+	}
+
+	close(release)
+	expectStarted(t, started, "dev")
+	queue.Wait()
+
+	for _, job := range []*jobs.Job{stage, dev, dump} {
+		if job.State() != jobs.StateDone {
+			t.Errorf("expected %s done, got %s", job.Name, job.State())
+		}
+	}
+}
+
+func TestFailedJobKeepsErrorAndLogs(t *testing.T) {
+	var logged []string
+	queue := jobs.NewQueue(func(format string, args ...interface{}) {
+		logged = append(logged, args[0].(string))
+	}, nil)
+
+	job := queue.Add("load stage", "stage", "", false, func(ctx context.Context, job *jobs.Job) error {
+		job.Logf("Loading %s", "stage")
+		return errors.New("no tables")
+	})
+	queue.Wait()
+
+	if job.State() != jobs.StateFailed || job.Err() == nil || job.Err().Error() != "no tables" {
+		t.Fatalf("expected failed job, got %s: %v", job.State(), job.Err())
+	}
+	logs := job.Logs()
+	if len(logs) != 2 || logs[0] != "Loading stage" {
+		t.Errorf("unexpected job logs %q", logs)
+	}
+	if len(logged) != 2 {
+		t.Errorf("job logs not passed on, got %q", logged)
+	}
+}
+
+func TestCancelRunningAndQueuedJobs(t *testing.T) {
+	queue := jobs.NewQueue(nil, nil)
+	started := make(chan string, 2)
+	release := make(chan struct{})
+	defer close(release)
+
+	running := queue.Add("dump stage", "stage", "", false, blocking(started, release, "dump"))
+	queued := queue.Add("load stage", "stage", "", false, blocking(started, release, "load"))
+	expectStarted(t, started, "dump")
+
+	if !queue.Cancel(queued) || !queue.Cancel(running) {
+		t.Fatal("expected unfinished jobs to be cancelled")
+	}
+	queue.Wait()
+
+	if !errors.Is(running.Err(), context.Canceled) || running.State() != jobs.StateFailed {
+		t.Errorf("expected cancelled running job, got %s: %v", running.State(), running.Err())
+	}
+	if queued.State() != jobs.StateFailed || queued.Duration() != 0 {
+		t.Errorf("cancelled job must not start, got %s", queued.State())
+	}
+	if queue.Cancel(running) {
+		t.Error("finished job can't be cancelled")
+	}
+
+	queue.ClearFinished()
+	if n := len(queue.Jobs()); n != 0 {
+		t.Errorf("expected finished jobs cleared, got %d", n)
+	}
+}
+
+func TestCancelAllStopsEverything(t *testing.T) {
+	queue := jobs.NewQueue(nil, nil)
+	started := make(chan string, 3)
+	release := make(chan struct{})
+	defer close(release)
+
+	dump := queue.Add("dump stage", "stage", "", false, blocking(started, release, "dump"))
+	load := queue.Add("load stage", "stage", "container local_postgres", false, blocking(started, release, "load"))
+	expectStarted(t, started, "dump")
+
+	running := queue.CancelAll()
+	queue.Wait()
+
+	if len(running) != 1 || running[0] != dump {
+		t.Errorf("expected only the dump reported as running, got %d jobs", len(running))
+	}
+	if !errors.Is(dump.Err(), context.Canceled) {
+		t.Errorf("expected cancelled dump, got %v", dump.Err())
+	}
+	if load.State() != jobs.StateFailed || load.Duration() != 0 {
+		t.Errorf("queued load must not start after cancel, got %s", load.State())
+	}
+}
@@ -1,88 +1,94 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"flag"
 	"fmt"
+	"io"
 	"os"
-	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
+	"dumper/catalog"
 	"dumper/config/app"
 	"dumper/config/db"
+	"dumper/config/env"
 	"dumper/database"
+	"dumper/jobs"
+	"dumper/masking"
 	"dumper/ui"
 
 	"github.com/jroimartin/gocui"
 )
 
 const (
-	// Container name
-	containerName = "local_postgres"
-
-	// PostgreSQL image
-	postgresImage = "postgres:16"
-
-	// Password for postgres user in container
-	postgresPassword = "pass"
-
-	// How long to wait for PostgreSQL to start in container
-	maxWaitSeconds = 30
-
 	// Directory for dumps
 	dumpsDir = "dumps"
 )
 
 type application struct {
-	ui       *ui.UI
-	cfg      *app.Config
-	localDb  *db.Connection
-	pgConfig database.PostgresConfig
-	debug    bool
+	ui      *ui.UI
+	cfg     *app.Config
+	catalog *catalog.Catalog
+	localDb *db.Connection
+	output  io.Writer // receives output of commands run against the local server
+	debug   bool
+
+	// logTo receives messages of a background job instead of the logs panel
+	logTo func(format string, args ...interface{})
 }
 
 func main() {
 	// Parse flags
 	debug := flag.Bool("debug", false, "Enable debug output")
+	flag.Usage = usage
 	flag.Parse()
 
 	// Load configuration
 	cfg, err := app.LoadConfig("config.yaml", dumpsDir)
 	if err != nil {
-		fmt.Printf("Error loading config: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
 		os.Exit(1)
 	}
 
-	// Create PostgreSQL configuration
-	pgConfig := database.PostgresConfig{
-		ContainerName:  containerName,
-		Image:          postgresImage,
-		Password:       postgresPassword,
-		MaxWaitSeconds: maxWaitSeconds,
-		Debug:          *debug,
-	}
+	// Create local connection with temporary database,
+	// it will be changed when environment is selected
+	localDb := cfg.LocalConnection(nil)
 
-	// Create local connection with temporary database
-	localDb := &db.Connection{
-		Host:     "localhost",
-		Port:     "5432",
-		User:     "postgres",
-		Password: postgresPassword,
-		Database: "postgres", // Will be changed when environment is selected
-		SslMode:  "disable",
+	app := &application{
+		cfg:     cfg,
+		catalog: catalog.New(dumpsDir),
+		localDb: localDb,
+		debug:   *debug,
 	}
 
-	app := &application{
-		cfg:      cfg,
-		localDb:  localDb,
-		pgConfig: pgConfig,
-		debug:    *debug,
+	// Output of commands run against the local server goes to the logs
+	app.output = &logWriter{log: app.log}
+
+	// Run headless command if one was given
+	if flag.NArg() > 0 {
+		if err := app.runCommand(flag.Args()); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
 	}
 
 	// Create UI
-	ui, err := ui.New(cfg, localDb,
+	ui, err := ui.New(cfg, localDb, app.catalog,
 		// Function to create dump
 		app.dump,
 		// Function to load dump
 		app.load,
+		// Function to copy database without a dump file
+		app.copy,
+		// Function to run the refresh pipeline
+		app.refresh,
+		// Functions to manage local container
+		app.containerStatus,
+		app.manageContainer,
 	)
 	if err != nil {
 		fmt.Printf("Error creating UI: %v\n", err)
@@ -98,23 +104,391 @@ func main() {
 	}
 }
 
-func (a *application) dump() error {
-	currentEnv := a.ui.GetCurrentEnvironment()
-	if currentEnv == nil {
-		return fmt.Errorf("environment not selected")
+func (a *application) dump(ctx context.Context, job *jobs.Job, e *env.Environment) error {
+	_, err := a.forJob(job).dumpEnvironment(ctx, e, "", job.Progress())
+	return err
+}
+
+func (a *application) load(ctx context.Context, job *jobs.Job, e *env.Environment, dumpID string) error {
+	return a.forJob(job).loadEnvironment(ctx, e, dumpID, job.Progress())
+}
+
+func (a *application) copy(ctx context.Context, job *jobs.Job, e *env.Environment) error {
+	return a.forJob(job).copyEnvironment(ctx, e, "", job.Progress())
+}
+
+func (a *application) refresh(ctx context.Context, job *jobs.Job, e *env.Environment) error {
+	pipeline, err := a.cfg.GetPipeline(env.RefreshPipeline)
+	if err != nil {
+		return err
+	}
+	return a.forJob(job).runPipeline(ctx, e, pipeline, job.Progress())
+}
+
+func (a *application) containerStatus(e *env.Environment) (database.ContainerStatus, error) {
+	return database.GetContainerStatus(a.postgresConfig(e))
+}
+
+func (a *application) manageContainer(job *jobs.Job, e *env.Environment, action database.ContainerAction) error {
+	return a.forJob(job).runContainerAction(e, action)
+}
+
+// forJob returns a copy of the application logging to the job
+func (a *application) forJob(job *jobs.Job) *application {
+	c := *a
+	c.logTo = job.Logf
+	c.output = &logWriter{log: job.Logf}
+	return &c
+}
+
+// runContainerAction runs a lifecycle action on the local container of the environment
+func (a *application) runContainerAction(e *env.Environment, action database.ContainerAction) error {
+	cfg := a.postgresConfig(e)
+	a.log("Running %s on container %s...", action, cfg.ContainerName)
+	if err := database.ManageContainer(cfg, action); err != nil {
+		return fmt.Errorf("failed to %s container: %w", action, err)
+	}
+	if action == database.ContainerDestroy {
+		// A new container starts on the configured port again
+		if err := a.cfg.ResetLocalPort(e); err != nil {
+			a.log("Warning: failed to reset port: %v", err)
+		}
+		a.refreshLocalDb(e)
+	}
+	a.log("Container %s: %s done", cfg.ContainerName, action)
+	return nil
+}
+
+// dumpEnvironment creates a new timestamped dump of the environment's database
+// and records it in the dump catalog. Subset overrides the environment's subset setting.
+// Progress is optional. Cancelling ctx stops the dump and removes the partial file.
+func (a *application) dumpEnvironment(ctx context.Context, e *env.Environment, subset string, progress *database.Progress) (catalog.Entry, error) {
+	format, err := database.ParseDumpFormat(e.DumpFormat)
+	if err != nil {
+		return catalog.Entry{}, err
+	}
+
+	compression, err := database.ParseCompression(e.Compression)
+	if err != nil {
+		return catalog.Entry{}, err
 	}
 
-	dumpFile := filepath.Join(dumpsDir, fmt.Sprintf("%s.sql", a.localDb.Database))
+	entry := a.catalog.NewEntry(e.Name, string(format), format.Extension()+compression.Extension())
+	defer a.catalog.Release(entry.ID) // the ID is kept reserved only until the dump fails or is added
+	entry.Compression = string(compression)
+	dumpFile := a.catalog.Path(entry)
 
 	// Execute dump operation
-	if err := database.DumpDatabase(currentEnv.DbDsn, dumpFile, a.debug); err != nil {
-		return fmt.Errorf("failed to create dump: %w", err)
+	opts := database.DumpOptions{
+		Format:           format,
+		Jobs:             e.Jobs,
+		Debug:            a.debug,
+		Schemas:          e.Schemas,
+		IncludeTables:    e.IncludeTables,
+		ExcludeTables:    e.ExcludeTables,
+		ExcludeTableData: e.ExcludeTableData,
+		Compression:      compression,
+		Output:           a.output,
+		Progress:         progress,
+	}
+
+	// The previous dump tells how long this one takes
+	if previous, err := a.catalog.Latest(e.Name); err == nil {
+		opts.ExpectedSize = previous.Size
+	}
+
+	if subset == "" {
+		subset = e.Subset
+	}
+	if subset != "" {
+		opts.Subset, err = database.ParseSubset(subset)
+		if err != nil {
+			return catalog.Entry{}, err
+		}
+		entry.Subset = opts.Subset.String()
+		a.log("Dumping subset: %s", entry.Subset)
+	}
+
+	rules, err := loadMaskingRules(e)
+	if err != nil {
+		return catalog.Entry{}, err
+	}
+	if rules != nil {
+		if format == database.FormatPlain {
+			opts.Filter = func(r io.Reader, w io.Writer) error {
+				stats, err := masking.MaskDump(r, w, rules)
+				a.logMaskingStats(stats)
+				return err
+			}
+			entry.Masked = true
+		} else {
+			a.log("Masking rules will be applied to the local database after load")
+		}
+	}
+
+	info, err := database.DumpDatabase(ctx, e.DbDsn, dumpFile, opts)
+	if err != nil {
+		os.RemoveAll(dumpFile)
+		return catalog.Entry{}, fmt.Errorf("failed to create dump: %w", err)
+	}
+	entry.ServerVersion = info.ServerVersion.String()
+
+	entry, err = a.catalog.Add(entry)
+	if err != nil {
+		return catalog.Entry{}, fmt.Errorf("failed to record dump: %w", err)
+	}
+
+	// Pruning failure shouldn't fail the dump itself
+	if _, err := a.pruneEnvironment(e, false); err != nil {
+		a.log("Warning: failed to prune old dumps: %v", err)
+	}
+
+	return entry, nil
+}
+
+// pruneEnvironment removes old dumps of the environment according to its retention settings
+func (a *application) pruneEnvironment(e *env.Environment, dryRun bool) ([]catalog.Entry, error) {
+	retention := a.cfg.GetRetention(e)
+	if retention.IsZero() {
+		return nil, nil
+	}
+
+	policy := catalog.Policy{
+		KeepLast:     retention.KeepLast,
+		MaxAge:       time.Duration(retention.MaxAgeDays) * 24 * time.Hour,
+		MaxTotalSize: int64(retention.MaxTotalSize),
+	}
+
+	removed, err := a.catalog.Prune(e.Name, policy, dryRun)
+	if !dryRun {
+		for _, entry := range removed {
+			a.log("Pruned dump %s (%s)", entry.Name(), catalog.FormatSize(entry.Size))
+		}
+	}
+	return removed, err
+}
+
+// log writes a message to the running job, the logs panel or stdout in headless mode
+func (a *application) log(format string, args ...interface{}) {
+	if a.logTo != nil {
+		a.logTo(format, args...)
+		return
+	}
+	if a.ui != nil {
+		a.ui.AddLog(format, args...)
+		return
+	}
+	logf(format, args...)
+}
+
+// postgresConfig returns settings of the local server the environment's dumps are loaded into
+func (a *application) postgresConfig(e *env.Environment) database.PostgresConfig {
+	local := a.cfg.GetLocal(e)
+
+	cfg := database.PostgresConfig{
+		ContainerName:  local.ContainerName,
+		Image:          local.Image,
+		Password:       local.Password,
+		Port:           local.Port,
+		Volume:         local.Volume,
+		MaxWaitSeconds: local.MaxWaitSeconds,
+		Debug:          a.debug,
+		Runtime:        local.Runtime,
+		Output:         a.output,
+	}
+	if local.IsNative() {
+		cfg.NativeDSN = a.cfg.LocalConnection(e).GetDSN()
+	}
+
+	// The container is published on another port if the configured one is taken,
+	// it is saved so that migrations and the connection panel use it too
+	cfg.OnPortChange = func(port int) {
+		if err := a.cfg.SetLocalPort(e, port); err != nil {
+			a.log("Warning: failed to save port: %v", err)
+		}
+		a.refreshLocalDb(e)
+	}
+	return cfg
+}
+
+// refreshLocalDb updates the local connection after the environment's local port changed.
+// Jobs run in the background, so the UI is updated in its main loop
+// and only if the environment is still selected.
+func (a *application) refreshLocalDb(e *env.Environment) {
+	if a.ui == nil {
+		*a.localDb = *a.cfg.LocalConnection(e)
+		return
+	}
+	a.ui.Do(func() {
+		if current := a.ui.GetCurrentEnvironment(); current != nil && current.Name == e.Name {
+			*a.localDb = *a.cfg.LocalConnection(e)
+		}
+	})
+}
+
+// logWriter writes output to the log line by line
+type logWriter struct {
+	log     func(format string, args ...interface{})
+	partial []byte
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		if line := strings.TrimRight(string(w.partial[:i]), "\r"); line != "" {
+			w.log("%s", line)
+		}
+		w.partial = w.partial[i+1:]
+	}
+}
+
+// loadEnvironment loads a dump of the environment into the local database.
+// Empty dumpID loads the latest dump. Progress is optional.
+// Cancelling ctx stops the restore and drops the half-restored database.
+func (a *application) loadEnvironment(ctx context.Context, e *env.Environment, dumpID string, progress *database.Progress) error {
+	entry, err := a.findDump(e, dumpID)
+	if err != nil {
+		return err
+	}
+
+	opts := database.RestoreOptions{
+		Jobs:     e.Jobs,
+		Schemas:  e.Schemas,
+		Progress: progress,
+	}
+	pgConfig := a.postgresConfig(e)
+
+	if entry.ServerVersion != "" {
+		if opts.SourceVersion, err = database.ParseVersion(entry.ServerVersion); err != nil {
+			return err
+		}
+		// Image only matters when the container is created, a running one is checked by LoadDump
+		if a.cfg.GetLocal(e).MatchesServerVersion() {
+			pgConfig.Image = database.ImageForVersion(pgConfig.Image, opts.SourceVersion)
+		}
+	}
+
+	if err := database.LoadDump(ctx, pgConfig, e.Name, a.catalog.Path(entry), opts); err != nil {
+		return err
+	}
+
+	// Dumps in archive formats are masked after restore
+	if entry.Masked {
+		return nil
+	}
+
+	rules, err := loadMaskingRules(e)
+	if err != nil || rules == nil {
+		return err
+	}
+
+	// Masking isn't cancelled, unmasked data must not be left in the database
+	a.log("Applying masking rules to %s...", e.Name)
+	// Not a.localDb, another environment may have been selected while loading
+	stats, err := masking.ApplyToDatabase(a.cfg.LocalConnection(e).GetDSN(), rules)
+	a.logMaskingStats(stats)
+	if err != nil {
+		return fmt.Errorf("failed to mask data: %w", err)
 	}
 
 	return nil
 }
 
-func (a *application) load() error {
-	dumpFile := filepath.Join(dumpsDir, fmt.Sprintf("%s.sql", a.localDb.Database))
-	return database.LoadDump(a.pgConfig, a.localDb.Database, dumpFile)
+// copyEnvironment streams the environment's database straight into the local database,
+// without a dump file or a catalog entry. Masking rules are applied to the stream.
+// Progress is optional. Cancelling ctx stops the copy and drops the half-copied database.
+func (a *application) copyEnvironment(ctx context.Context, e *env.Environment, subset string, progress *database.Progress) error {
+	opts := database.PipeOptions{
+		DumpOptions: database.DumpOptions{
+			Debug:            a.debug,
+			Schemas:          e.Schemas,
+			IncludeTables:    e.IncludeTables,
+			ExcludeTables:    e.ExcludeTables,
+			ExcludeTableData: e.ExcludeTableData,
+			Output:           a.output,
+			Progress:         progress,
+		},
+		MatchServerVersion: a.cfg.GetLocal(e).MatchesServerVersion(),
+	}
+
+	// Only an uncompressed plain dump has the size of the stream
+	if previous, err := a.catalog.Latest(e.Name); err == nil &&
+		previous.Format == string(database.FormatPlain) && previous.Compression == "" {
+		opts.ExpectedSize = previous.Size
+	}
+
+	if subset == "" {
+		subset = e.Subset
+	}
+	if subset != "" {
+		var err error
+		if opts.Subset, err = database.ParseSubset(subset); err != nil {
+			return err
+		}
+		a.log("Copying subset: %s", opts.Subset)
+	}
+
+	rules, err := loadMaskingRules(e)
+	if err != nil {
+		return err
+	}
+	if rules != nil {
+		opts.Filter = func(r io.Reader, w io.Writer) error {
+			stats, err := masking.MaskDump(r, w, rules)
+			a.logMaskingStats(stats)
+			return err
+		}
+	}
+
+	if _, err := database.PipeDatabase(ctx, e.DbDsn, a.postgresConfig(e), e.Name, opts); err != nil {
+		return fmt.Errorf("failed to copy database: %w", err)
+	}
+	return nil
+}
+
+// loadMaskingRules loads masking rules of the environment, nil if none are configured
+func loadMaskingRules(e *env.Environment) (*masking.Rules, error) {
+	if e.MaskingRules == "" {
+		return nil, nil
+	}
+	return masking.LoadRules(e.MaskingRules)
+}
+
+// logMaskingStats logs number of masked rows per table and rules that were skipped
+func (a *application) logMaskingStats(stats masking.Stats) {
+	tables := make([]string, 0, len(stats.Rows))
+	var total int64
+	for table, rows := range stats.Rows {
+		tables = append(tables, table)
+		total += rows
+	}
+	sort.Strings(tables)
+
+	for _, table := range tables {
+		a.log("Masked %d rows in %s", stats.Rows[table], table)
+	}
+	a.log("Masked %d rows in total", total)
+	for _, rule := range stats.Skipped {
+		a.log("Warning: masking rule %s skipped, the column was not found", rule)
+	}
+}
+
+// findDump returns the dump with given ID or the latest dump of the environment
+func (a *application) findDump(e *env.Environment, dumpID string) (catalog.Entry, error) {
+	if dumpID == "" {
+		return a.catalog.Latest(e.Name)
+	}
+
+	entry, err := a.catalog.Get(dumpID)
+	if err != nil {
+		return catalog.Entry{}, err
+	}
+	if entry.Environment != e.Name {
+		return catalog.Entry{}, fmt.Errorf("dump %s belongs to environment %s", entry.ID, entry.Environment)
+	}
+	return entry, nil
 }
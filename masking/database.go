@@ -0,0 +1,131 @@
+package masking
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	_ "github.com/lib/pq" // PostgreSQL driver
+)
+
+// ApplyToDatabase masks data in an already restored database. Rules whose table or column
+// doesn't exist are skipped and reported in stats, like when masking a dump.
+func ApplyToDatabase(dbDsn string, rules *Rules) (Stats, error) {
+	db, err := sql.Open("postgres", dbDsn)
+	if err != nil {
+		return Stats{}, fmt.Errorf("error connecting to database: %w", err)
+	}
+	defer db.Close()
+
+	tables := make([]string, 0, len(rules.tables))
+	for table := range rules.tables {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+
+	stats := newStats()
+	applied := make(map[Rule]bool)
+	for _, table := range tables {
+		tableRules := rules.tables[table]
+		columns, err := tableColumns(db, tableRules[0].Schema, tableRules[0].Table)
+		if err != nil {
+			return stats, fmt.Errorf("error masking table %s: %w", table, err)
+		}
+
+		var found []Rule
+		for _, rule := range tableRules {
+			if columns[rule.Column] {
+				found = append(found, rule)
+			}
+		}
+		query := updateQuery(found)
+		if query == "" {
+			continue
+		}
+
+		result, err := db.Exec(query)
+		if err != nil {
+			return stats, fmt.Errorf("error masking table %s: %w", table, err)
+		}
+
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return stats, fmt.Errorf("error masking table %s: %w", table, err)
+		}
+		stats.Rows[table] = rows
+		for _, rule := range found {
+			applied[rule] = true
+		}
+	}
+
+	stats.Skipped = rules.except(applied)
+	return stats, nil
+}
+
+// tableColumns returns names of the table's columns, none if the table doesn't exist
+func tableColumns(db *sql.DB, schema, table string) (map[string]bool, error) {
+	rows, err := db.Query("SELECT column_name FROM information_schema.columns WHERE table_schema = $1 AND table_name = $2",
+		schema, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		columns[name] = true
+	}
+	return columns, rows.Err()
+}
+
+// updateQuery builds UPDATE statement masking all columns of a table.
+// Only rows with at least one non-NULL masked value are updated, which
+// matches the rows counted when masking a dump.
+func updateQuery(rules []Rule) string {
+	var set, where []string
+	for _, rule := range rules {
+		if rule.Strategy == Keep {
+			continue
+		}
+		column := quoteIdentifier(rule.Column)
+		set = append(set, fmt.Sprintf("%s = %s", column, maskExpression(column, rule)))
+		where = append(where, column+" IS NOT NULL")
+	}
+
+	if len(set) == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("UPDATE %s.%s SET %s WHERE %s",
+		quoteIdentifier(rules[0].Schema), quoteIdentifier(rules[0].Table),
+		strings.Join(set, ", "), strings.Join(where, " OR "))
+}
+
+// maskExpression returns SQL expression producing the same values as maskValue
+func maskExpression(column string, rule Rule) string {
+	digest := fmt.Sprintf("encode(sha256(convert_to(%s::text, 'UTF8')), 'hex')", column)
+
+	switch rule.Strategy {
+	case FakeEmail:
+		return fmt.Sprintf("CASE WHEN %s IS NULL THEN NULL ELSE 'user_' || left(%s, 12) || '@example.com' END", column, digest)
+	case Hash:
+		return fmt.Sprintf("CASE WHEN %s IS NULL THEN NULL ELSE %s END", column, digest)
+	case Constant:
+		return fmt.Sprintf("CASE WHEN %s IS NULL THEN NULL ELSE %s END", column, quoteLiteral(rule.Value))
+	default:
+		return "NULL"
+	}
+}
+
+func quoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func quoteLiteral(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
@@ -0,0 +1,61 @@
+package masking
+
+import "testing"
+
+func TestUpdateQuery(t *testing.T) {
+	users := func(column string, strategy Strategy, value string) Rule {
+		return Rule{Schema: "public", Table: "users", Column: column, Strategy: strategy, Value: value}
+	}
+
+	tests := []struct {
+		name  string
+		rules []Rule
+		want  string
+	}{
+		{
+			name:  "null",
+			rules: []Rule{users("phone", Null, "")},
+			want:  `UPDATE "public"."users" SET "phone" = NULL WHERE "phone" IS NOT NULL`,
+		},
+		{
+			name:  "constant is quoted",
+			rules: []Rule{users("note", Constant, "it's")},
+			want:  `UPDATE "public"."users" SET "note" = CASE WHEN "note" IS NULL THEN NULL ELSE 'it''s' END WHERE "note" IS NOT NULL`,
+		},
+		{
+			name:  "identifiers are quoted",
+			rules: []Rule{{Schema: `we"ird`, Table: "Users", Column: `a"b`, Strategy: Null}},
+			want:  `UPDATE "we""ird"."Users" SET "a""b" = NULL WHERE "a""b" IS NOT NULL`,
+		},
+		{
+			name:  "keep is left out",
+			rules: []Rule{users("id", Keep, ""), users("phone", Null, ""), users("fax", Null, "")},
+			want:  `UPDATE "public"."users" SET "phone" = NULL, "fax" = NULL WHERE "phone" IS NOT NULL OR "fax" IS NOT NULL`,
+		},
+		{
+			name:  "only keep",
+			rules: []Rule{users("id", Keep, "")},
+			want:  "",
+		},
+		{
+			name:  "no rules",
+			rules: nil,
+			want:  "",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := updateQuery(tt.rules); got != tt.want {
+			t.Errorf("%s:\n got %s\nwant %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMaskExpressionFakeEmail(t *testing.T) {
+	// Same value as maskValue writes into dumps: user_ and 12 hex digits of sha256
+	rule := Rule{Column: "email", Strategy: FakeEmail}
+	want := `CASE WHEN "email" IS NULL THEN NULL ELSE 'user_' || left(encode(sha256(convert_to("email"::text, 'UTF8')), 'hex'), 12) || '@example.com' END`
+	if got := maskExpression(`"email"`, rule); got != want {
+		t.Errorf("got %s\nwant %s", got, want)
+	}
+}
@@ -0,0 +1,235 @@
+package masking
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Stats reports what masking did. Rules whose table or column doesn't exist are skipped
+// the same way when masking a dump and a database, and reported in Skipped.
+type Stats struct {
+	Rows    map[string]int64 // masked rows by schema.table
+	Skipped []Rule           // rules not applied since their table or column wasn't found
+}
+
+func newStats() Stats {
+	return Stats{Rows: make(map[string]int64)}
+}
+
+// nullValue is NULL in COPY text format
+const nullValue = `\N`
+
+// copyHeader matches COPY statement pg_dump writes before table data
+var copyHeader = regexp.MustCompile(`^COPY (.+) \((.*)\) FROM stdin;$`)
+
+// MaskDump copies a plain SQL dump from r to w, masking data of COPY blocks
+// according to the rules
+func MaskDump(r io.Reader, w io.Writer, rules *Rules) (Stats, error) {
+	reader := bufio.NewReaderSize(r, 1<<20)
+	writer := bufio.NewWriterSize(w, 1<<20)
+	stats := newStats()
+	applied := make(map[Rule]bool)
+
+	var table string
+	var columns map[int]Rule // column index -> rule, nil outside of masked COPY block
+
+	for {
+		line, err := reader.ReadString('\n')
+		if len(line) > 0 {
+			switch {
+			case columns != nil && line == "\\.\n":
+				columns = nil
+			case columns != nil:
+				var masked bool
+				line, masked = maskRow(line, columns)
+				if masked {
+					stats.Rows[table]++
+				}
+			default:
+				table, columns = parseCopyHeader(line, rules)
+				for _, rule := range columns {
+					applied[rule] = true
+				}
+			}
+
+			if _, err := writer.WriteString(line); err != nil {
+				return stats, err
+			}
+		}
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return stats, err
+		}
+	}
+
+	stats.Skipped = rules.except(applied)
+	return stats, writer.Flush()
+}
+
+// parseCopyHeader returns table name and rules by column index if line starts data of a masked table
+func parseCopyHeader(line string, rules *Rules) (string, map[int]Rule) {
+	match := copyHeader.FindStringSubmatch(strings.TrimSuffix(line, "\n"))
+	if match == nil {
+		return "", nil
+	}
+
+	name := splitIdentifiers(match[1], '.')
+	schema, table := "public", name[len(name)-1]
+	if len(name) > 1 {
+		schema = name[len(name)-2]
+	}
+
+	tableRules := rules.forTable(schema, table)
+	if len(tableRules) == 0 {
+		return "", nil
+	}
+
+	columns := make(map[int]Rule)
+	for i, column := range splitIdentifiers(match[2], ',') {
+		for _, rule := range tableRules {
+			if rule.Column == column && rule.Strategy != Keep {
+				columns[i] = rule
+			}
+		}
+	}
+	if len(columns) == 0 {
+		return "", nil
+	}
+
+	return schema + "." + table, columns
+}
+
+// maskRow masks values of a COPY data row, reports whether any value was changed
+func maskRow(line string, columns map[int]Rule) (string, bool) {
+	fields := strings.Split(strings.TrimSuffix(line, "\n"), "\t")
+	var masked bool
+
+	for i, rule := range columns {
+		if i >= len(fields) || fields[i] == nullValue {
+			continue
+		}
+		fields[i] = maskValue(fields[i], rule)
+		masked = true
+	}
+
+	return strings.Join(fields, "\t") + "\n", masked
+}
+
+// maskValue returns masked value in COPY text format
+func maskValue(value string, rule Rule) string {
+	switch rule.Strategy {
+	case FakeEmail:
+		return "user_" + hashHex(unescapeCopy(value))[:12] + "@example.com"
+	case Hash:
+		return hashHex(unescapeCopy(value))
+	case Null:
+		return nullValue
+	case Constant:
+		return escapeCopy(rule.Value)
+	default:
+		return value
+	}
+}
+
+func hashHex(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+// splitIdentifiers splits a list of possibly quoted SQL identifiers and unquotes them
+func splitIdentifiers(s string, sep rune) []string {
+	var result []string
+	var current strings.Builder
+	quoted := false
+	runes := []rune(s)
+
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		switch {
+		case c == '"' && quoted && i+1 < len(runes) && runes[i+1] == '"':
+			current.WriteRune('"')
+			i++
+		case c == '"':
+			quoted = !quoted
+		case c == sep && !quoted:
+			result = append(result, strings.TrimSpace(current.String()))
+			current.Reset()
+		default:
+			current.WriteRune(c)
+		}
+	}
+
+	return append(result, strings.TrimSpace(current.String()))
+}
+
+var copyEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+// escapeCopy escapes value for COPY text format
+func escapeCopy(value string) string {
+	return copyEscaper.Replace(value)
+}
+
+// unescapeCopy decodes a value in COPY text format
+func unescapeCopy(value string) string {
+	if !strings.Contains(value, `\`) {
+		return value
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' || i+1 == len(value) {
+			b.WriteByte(value[i])
+			continue
+		}
+
+		i++
+		switch c := value[i]; c {
+		case 'b':
+			b.WriteByte('\b')
+		case 'f':
+			b.WriteByte('\f')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case 'v':
+			b.WriteByte('\v')
+		case 'x':
+			end := i + 1
+			for end < len(value) && end < i+3 && isHex(value[end]) {
+				end++
+			}
+			if n, err := strconv.ParseUint(value[i+1:end], 16, 8); err == nil {
+				b.WriteByte(byte(n))
+				i = end - 1
+			} else {
+				b.WriteByte(c)
+			}
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			end := i
+			for end < len(value) && end < i+3 && value[end] >= '0' && value[end] <= '7' {
+				end++
+			}
+			n, _ := strconv.ParseUint(value[i:end], 8, 8)
+			b.WriteByte(byte(n))
+			i = end - 1
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+func isHex(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
@@ -0,0 +1,165 @@
+package masking
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMaskDump(t *testing.T) {
+	rules := loadRules(t, `
+rules:
+  users.email: fake_email
+  users.password: hash
+  users.phone: null
+  users.note:
+    strategy: constant
+    value: "it's\tsecret"
+  users.id: keep
+  audit.log.payload: null
+  users.missing: hash
+  ghosts.name: hash
+`)
+	dump := strings.Join([]string{
+		"SET client_encoding = 'UTF8';",
+		"COPY public.users (id, email, password, phone, note) FROM stdin;",
+		"1\tbob@corp.com\tpw\t555\thi",
+		"2\t\\N\t\\N\t\\N\t\\N",
+		"\\.",
+		"",
+		`COPY "audit"."log" ("id", "payload") FROM stdin;`,
+		"7\t{\"a\": 1}",
+		"\\.",
+		"COPY public.orders (id) FROM stdin;",
+		"1",
+		"\\.",
+		"",
+	}, "\n")
+
+	var out strings.Builder
+	stats, err := MaskDump(strings.NewReader(dump), &out, rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := strings.Join([]string{
+		"SET client_encoding = 'UTF8';",
+		"COPY public.users (id, email, password, phone, note) FROM stdin;",
+		"1\tuser_" + hashHex("bob@corp.com")[:12] + "@example.com\t" + hashHex("pw") + "\t\\N\tit's\\tsecret",
+		"2\t\\N\t\\N\t\\N\t\\N",
+		"\\.",
+		"",
+		`COPY "audit"."log" ("id", "payload") FROM stdin;`,
+		"7\t\\N",
+		"\\.",
+		"COPY public.orders (id) FROM stdin;",
+		"1",
+		"\\.",
+		"",
+	}, "\n")
+	if out.String() != want {
+		t.Errorf("unexpected dump:\n got %q\nwant %q", out.String(), want)
+	}
+
+	if stats.Rows["public.users"] != 1 || stats.Rows["audit.log"] != 1 || len(stats.Rows) != 2 {
+		t.Errorf("unexpected masked rows %v", stats.Rows)
+	}
+	var skipped []string
+	for _, rule := range stats.Skipped {
+		skipped = append(skipped, rule.String())
+	}
+	if strings.Join(skipped, ",") != "public.ghosts.name,public.users.missing" {
+		t.Errorf("expected rules of missing table and column skipped, got %q", skipped)
+	}
+}
+
+func TestParseCopyHeader(t *testing.T) {
+	rules := loadRules(t, `
+rules:
+  users.email: hash
+  sales.Orders.total: null
+  "public.odd,name.a b": null
+`)
+
+	tests := []struct {
+		line    string
+		table   string
+		columns map[int]string // index -> masked column
+	}{
+		{"COPY public.users (id, email) FROM stdin;\n", "public.users", map[int]string{1: "email"}},
+		{"COPY users (email) FROM stdin;\n", "public.users", map[int]string{0: "email"}},
+		{`COPY sales."Orders" (id, "total") FROM stdin;` + "\n", "sales.Orders", map[int]string{1: "total"}},
+		{`COPY public."odd,name" ("x,y", "a b") FROM stdin;` + "\n", "public.odd,name", map[int]string{1: "a b"}},
+		{"COPY public.orders (id) FROM stdin;\n", "", nil},
+		{"COPY public.users (id) FROM stdin;\n", "", nil},
+		{"CREATE TABLE public.users (id int);\n", "", nil},
+	}
+
+	for _, tt := range tests {
+		table, columns := parseCopyHeader(tt.line, rules)
+		if table != tt.table || len(columns) != len(tt.columns) {
+			t.Errorf("%q: got %s with %d columns, want %s with %d", tt.line, table, len(columns), tt.table, len(tt.columns))
+			continue
+		}
+		for i, column := range tt.columns {
+			if columns[i].Column != column {
+				t.Errorf("%q: column %d got %q, want %q", tt.line, i, columns[i].Column, column)
+			}
+		}
+	}
+}
+
+func TestSplitIdentifiers(t *testing.T) {
+	tests := []struct {
+		in   string
+		sep  rune
+		want []string
+	}{
+		{"id, email", ',', []string{"id", "email"}},
+		{`"a,b", "c ""d"""`, ',', []string{"a,b", `c "d"`}},
+		{`public."my.table"`, '.', []string{"public", "my.table"}},
+		{"users", '.', []string{"users"}},
+	}
+
+	for _, tt := range tests {
+		got := splitIdentifiers(tt.in, tt.sep)
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("%q: got %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestUnescapeCopy(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"plain", "plain"},
+		{`a\tb\nc\rd`, "a\tb\nc\rd"},
+		{`back\\slash`, `back\slash`},
+		{`\b\f\v`, "\b\f\v"},
+		{`\x41\x4a`, "AJ"},
+		{`\101\60`, "A0"},
+		{`\xZZ`, "xZZ"},
+		{`trailing\`, `trailing\`},
+	}
+
+	for _, tt := range tests {
+		if got := unescapeCopy(tt.in); got != tt.want {
+			t.Errorf("unescapeCopy(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestEscapeCopyRoundTrip(t *testing.T) {
+	for _, value := range []string{"plain", "tab\there", "new\nline\r", `back\slash`, `\N`} {
+		escaped := escapeCopy(value)
+		if strings.ContainsAny(escaped, "\t\n\r") {
+			t.Errorf("escapeCopy(%q) = %q contains separators", value, escaped)
+		}
+		if escaped == nullValue {
+			t.Errorf("escapeCopy(%q) must not produce NULL", value)
+		}
+		if got := unescapeCopy(escaped); got != value {
+			t.Errorf("round trip of %q gave %q", value, got)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package masking
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Strategy defines how values of a column are masked
+type Strategy string
+
+const (
+	// FakeEmail replaces value with a deterministic fake address
+	FakeEmail Strategy = "fake_email"
+	// Hash replaces value with its sha256 hex digest
+	Hash Strategy = "hash"
+	// Null replaces value with NULL
+	Null Strategy = "null"
+	// Constant replaces value with a fixed string
+	Constant Strategy = "constant"
+	// Keep leaves value unchanged
+	Keep Strategy = "keep"
+)
+
+// Rule describes masking of a single column
+type Rule struct {
+	Schema   string
+	Table    string
+	Column   string
+	Strategy Strategy
+	Value    string // replacement for Constant strategy
+}
+
+// String returns the column the rule masks, like public.users.email
+func (r Rule) String() string {
+	return r.Schema + "." + r.Table + "." + r.Column
+}
+
+// Rules is a set of masking rules grouped by table
+type Rules struct {
+	tables map[string][]Rule // keyed by schema.table
+}
+
+// ruleSpec is a rule as written in the rules file: either a strategy name
+// or an object with strategy and value
+type ruleSpec struct {
+	Strategy Strategy `yaml:"strategy"`
+	Value    string   `yaml:"value"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler
+func (r *ruleSpec) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var strategy string
+	if err := unmarshal(&strategy); err == nil {
+		r.Strategy = Strategy(strategy)
+		return nil
+	}
+
+	type plain ruleSpec
+	return unmarshal((*plain)(r))
+}
+
+// rulesFile represents the layout of the rules file
+type rulesFile struct {
+	Rules map[string]ruleSpec `yaml:"rules"`
+}
+
+// LoadRules loads masking rules from a YAML file.
+// Rules are keyed by "table.column" or "schema.table.column":
+//
+//	rules:
+//	  users.email: fake_email
+//	  billing.cards.number: null
+//	  users.notes:
+//	    strategy: constant
+//	    value: redacted
+func LoadRules(path string) (*Rules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading masking rules: %w", err)
+	}
+
+	var file rulesFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("error parsing masking rules: %w", err)
+	}
+
+	rules := &Rules{tables: make(map[string][]Rule)}
+	for key, spec := range file.Rules {
+		rule, err := parseRule(key, spec)
+		if err != nil {
+			return nil, err
+		}
+		table := rule.Schema + "." + rule.Table
+		rules.tables[table] = append(rules.tables[table], rule)
+	}
+
+	return rules, nil
+}
+
+func parseRule(key string, spec ruleSpec) (Rule, error) {
+	parts := strings.Split(key, ".")
+	rule := Rule{Schema: "public", Strategy: spec.Strategy, Value: spec.Value}
+
+	switch len(parts) {
+	case 2:
+		rule.Table, rule.Column = parts[0], parts[1]
+	case 3:
+		rule.Schema, rule.Table, rule.Column = parts[0], parts[1], parts[2]
+	default:
+		return Rule{}, fmt.Errorf("invalid masking rule %q: expected table.column or schema.table.column", key)
+	}
+
+	// Unquoted null in YAML is parsed as an empty value
+	if rule.Strategy == "" {
+		rule.Strategy = Null
+	}
+
+	switch rule.Strategy {
+	case FakeEmail, Hash, Null, Constant, Keep:
+	default:
+		return Rule{}, fmt.Errorf("invalid masking rule %q: unknown strategy %q", key, rule.Strategy)
+	}
+
+	return rule, nil
+}
+
+// forTable returns rules of the table
+func (r *Rules) forTable(schema, table string) []Rule {
+	return r.tables[schema+"."+table]
+}
+
+// except returns rules changing data that are not in applied, sorted by column
+func (r *Rules) except(applied map[Rule]bool) []Rule {
+	var rest []Rule
+	for _, tableRules := range r.tables {
+		for _, rule := range tableRules {
+			if rule.Strategy != Keep && !applied[rule] {
+				rest = append(rest, rule)
+			}
+		}
+	}
+	sort.Slice(rest, func(i, j int) bool { return rest[i].String() < rest[j].String() })
+	return rest
+}
@@ -0,0 +1,71 @@
+package masking
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// loadRules loads rules from YAML written to a temporary file
+func loadRules(t *testing.T, yaml string) *Rules {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rules, err := LoadRules(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rules
+}
+
+func TestParseRule(t *testing.T) {
+	tests := []struct {
+		key     string
+		spec    ruleSpec
+		want    Rule
+		wantErr bool
+	}{
+		{"users.email", ruleSpec{Strategy: FakeEmail}, Rule{Schema: "public", Table: "users", Column: "email", Strategy: FakeEmail}, false},
+		{"billing.cards.number", ruleSpec{Strategy: Hash}, Rule{Schema: "billing", Table: "cards", Column: "number", Strategy: Hash}, false},
+		{"users.notes", ruleSpec{Strategy: Constant, Value: "x"}, Rule{Schema: "public", Table: "users", Column: "notes", Strategy: Constant, Value: "x"}, false},
+		{"users.phone", ruleSpec{}, Rule{Schema: "public", Table: "users", Column: "phone", Strategy: Null}, false},
+		{"email", ruleSpec{Strategy: Hash}, Rule{}, true},
+		{"a.b.c.d", ruleSpec{Strategy: Hash}, Rule{}, true},
+		{"users.email", ruleSpec{Strategy: "scramble"}, Rule{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseRule(tt.key, tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: unexpected error %v", tt.key, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestLoadRulesGroupsByTable(t *testing.T) {
+	rules := loadRules(t, `
+rules:
+  users.email: fake_email
+  users.phone: null
+  billing.cards.number:
+    strategy: constant
+    value: "0000"
+`)
+
+	if n := len(rules.forTable("public", "users")); n != 2 {
+		t.Errorf("expected 2 rules for public.users, got %d", n)
+	}
+	cards := rules.forTable("billing", "cards")
+	if len(cards) != 1 || cards[0].Strategy != Constant || cards[0].Value != "0000" {
+		t.Errorf("unexpected rules for billing.cards: %+v", cards)
+	}
+	if len(rules.forTable("public", "cards")) != 0 {
+		t.Error("schema must be part of the table key")
+	}
+}
@@ -1,10 +1,12 @@
 package migrations
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"path/filepath"
 	"sort"
+	"sync"
 
 	_ "github.com/lib/pq" // PostgreSQL driver
 	"github.com/pressly/goose/v3"
@@ -88,8 +90,16 @@ func GetMigrationStatus(dbDsn string, migrationsDir string, onLog func(string, .
 	return result, nil
 }
 
-// MigrateTo migrates database to specified version
-func MigrateTo(dbDsn string, migrationsDir string, targetVersion int64, onLog func(string, ...interface{})) error {
+// migrateMu serializes migrations, goose keeps its logger in a global
+var migrateMu sync.Mutex
+
+// MigrateTo migrates database to specified version.
+// Cancelling ctx stops before the next migration and interrupts the running one,
+// which is rolled back if it runs in a transaction.
+func MigrateTo(ctx context.Context, dbDsn string, migrationsDir string, targetVersion int64, onLog func(string, ...interface{})) error {
+	migrateMu.Lock()
+	defer migrateMu.Unlock()
+
 	// Set up logger
 	goose.SetLogger(&Logger{onLog: onLog})
 
@@ -107,7 +117,7 @@ func MigrateTo(dbDsn string, migrationsDir string, targetVersion int64, onLog fu
 	defer db.Close()
 
 	// Get current version
-	currentVersion, err := goose.GetDBVersion(db)
+	currentVersion, err := goose.GetDBVersionContext(ctx, db)
 	if err != nil {
 		return fmt.Errorf("error getting current version: %w", err)
 	}
@@ -115,15 +125,47 @@ func MigrateTo(dbDsn string, migrationsDir string, targetVersion int64, onLog fu
 	// Choose migration direction
 	if targetVersion > currentVersion {
 		// Migrate up
-		if err := goose.UpTo(db, absPath, targetVersion); err != nil {
-			return fmt.Errorf("error migrating up: %w", err)
+		if err := goose.UpToContext(ctx, db, absPath, targetVersion); err != nil {
+			return migrationError(ctx, "up", err)
 		}
 	} else if targetVersion < currentVersion {
 		// Migrate down
-		if err := goose.DownTo(db, absPath, targetVersion); err != nil {
-			return fmt.Errorf("error migrating down: %w", err)
+		if err := goose.DownToContext(ctx, db, absPath, targetVersion); err != nil {
+			return migrationError(ctx, "down", err)
 		}
 	}
 
 	return nil
 }
+
+// migrationError tells a cancelled migration apart from a failed one
+func migrationError(ctx context.Context, direction string, err error) error {
+	if ctx.Err() != nil {
+		return fmt.Errorf("migration cancelled: %w", ctx.Err())
+	}
+	return fmt.Errorf("error migrating %s: %w", direction, err)
+}
+
+// LatestVersion returns the version of the newest migration in the directory
+func LatestVersion(migrationsDir string) (int64, error) {
+	absPath, err := filepath.Abs(migrationsDir)
+	if err != nil {
+		return 0, fmt.Errorf("error getting absolute path: %w", err)
+	}
+
+	migrations, err := goose.CollectMigrations(absPath, 0, goose.MaxVersion)
+	if err != nil {
+		return 0, fmt.Errorf("error reading migrations: %w", err)
+	}
+
+	if len(migrations) == 0 {
+		return 0, fmt.Errorf("no migrations found in %s", migrationsDir)
+	}
+
+	last, err := migrations.Last()
+	if err != nil {
+		return 0, fmt.Errorf("error reading migrations: %w", err)
+	}
+
+	return last.Version, nil
+}
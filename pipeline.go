@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"dumper/catalog"
+	"dumper/config/env"
+	"dumper/database"
+	"dumper/migrations"
+)
+
+// runPipeline runs steps of the pipeline on the environment, stopping at the first failure.
+// Progress is optional, it is reset for every dump, load and copy.
+func (a *application) runPipeline(ctx context.Context, e *env.Environment, p env.Pipeline, progress *database.Progress) error {
+	steps, err := p.ParseSteps()
+	if err != nil {
+		return err
+	}
+
+	run := pipelineRun{application: a, env: e, progress: progress}
+	started := time.Now()
+	for i, step := range steps {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("%s cancelled: %w", p.Name, err)
+		}
+		a.log("Step %d/%d of %s: %s", i+1, len(steps), p.Name, step)
+		if err := run.step(ctx, step); err != nil {
+			return fmt.Errorf("step %s failed: %w", step, err)
+		}
+	}
+
+	a.log("%s of %s finished in %s", p.Name, e.Name, time.Since(started).Round(time.Second))
+	return nil
+}
+
+// pipelineRun keeps state of a running pipeline
+type pipelineRun struct {
+	*application
+	env        *env.Environment
+	progress   *database.Progress
+	migratedTo int64 // version the migrate step migrated to, 0 if it didn't run
+}
+
+func (r *pipelineRun) step(ctx context.Context, step env.Step) error {
+	e := r.env
+
+	switch step.Action {
+	case env.StepDump:
+		r.progress.Reset()
+		entry, err := r.dumpEnvironment(ctx, e, "", r.progress)
+		if err != nil {
+			return err
+		}
+		r.log("Created dump %s (%s)", entry.ID, catalog.FormatSize(entry.Size))
+		return nil
+
+	case env.StepLoad:
+		r.progress.Reset()
+		return r.loadEnvironment(ctx, e, "", r.progress)
+
+	case env.StepCopy:
+		r.progress.Reset()
+		return r.copyEnvironment(ctx, e, "", r.progress)
+
+	case env.StepMigrate:
+		if e.MigrationsDir == "" {
+			r.log("Skipping migrate: migrations directory not specified for %s", e.Name)
+			return nil
+		}
+		version, err := parseVersion(step.Arg, e.MigrationsDir)
+		if err != nil {
+			return err
+		}
+		// Not a.localDb, the local port may have changed while loading
+		if err := migrations.MigrateTo(ctx, r.cfg.LocalConnection(e).GetDSN(), e.MigrationsDir, version, r.log); err != nil {
+			return err
+		}
+		r.migratedTo = version
+		return nil
+
+	case env.StepVerify:
+		return r.verify(ctx)
+	}
+	return fmt.Errorf("unknown step %s", step)
+}
+
+// verify checks that the local database has tables and the migrations up to the version
+// of the migrate step are applied
+func (r *pipelineRun) verify(ctx context.Context) error {
+	e := r.env
+
+	tables, err := database.CountTables(ctx, r.postgresConfig(e), e.Name, e.Schemas)
+	if err != nil {
+		return err
+	}
+	if tables == 0 {
+		return fmt.Errorf("no tables in local database %s", e.Name)
+	}
+	r.log("Local database %s has %d tables", e.Name, tables)
+
+	if r.migratedTo == 0 {
+		return nil
+	}
+	status, err := migrations.GetMigrationStatus(r.cfg.LocalConnection(e).GetDSN(), e.MigrationsDir, r.log)
+	if err != nil {
+		return err
+	}
+	applied := 0
+	for _, m := range status {
+		if m.ID > r.migratedTo {
+			continue
+		}
+		if !m.Applied {
+			return fmt.Errorf("migration %s is not applied", m.ShortName)
+		}
+		applied++
+	}
+	r.log("%d migrations applied up to version %d", applied, r.migratedTo)
+	return nil
+}
@@ -2,9 +2,11 @@ package components
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/jroimartin/gocui"
 
+	"dumper/config/app"
 	"dumper/config/db"
 	"dumper/config/env"
 	"dumper/ui/theme"
@@ -14,14 +16,16 @@ import (
 // ConnectionView represents the connection information display component
 type ConnectionView struct {
 	gui        *gocui.Gui
+	cfg        *app.Config
 	currentEnv *env.Environment
 	localDb    *db.Connection
 }
 
 // NewConnectionView creates a new connection view component
-func NewConnectionView(g *gocui.Gui, localDb *db.Connection) *ConnectionView {
+func NewConnectionView(g *gocui.Gui, cfg *app.Config, localDb *db.Connection) *ConnectionView {
 	return &ConnectionView{
 		gui:     g,
+		cfg:     cfg,
 		localDb: localDb,
 	}
 }
@@ -66,20 +70,73 @@ func (c *ConnectionView) updateConnectionInfo(v *gocui.View) {
 		return
 	}
 
-	fmt.Fprintln(v, " Local database:")
-	fmt.Fprintf(v, "   Host:     %s\n", c.localDb.Host)
-	fmt.Fprintf(v, "   Port:     %s\n", c.localDb.Port)
-	fmt.Fprintf(v, "   Database: %s\n", c.localDb.Database)
-	fmt.Fprintf(v, "   User:     %s\n", c.localDb.User)
-	fmt.Fprintf(v, "   Password: %s\n", c.localDb.Password)
-
-	fmt.Fprintln(v, "\n Remote database:")
-	remote, err := db.ParseDSN(c.currentEnv.DbDsn)
-	if err != nil {
-		fmt.Fprintf(v, " Error parsing DSN: %v\n", err)
-		return
+	local := []string{
+		" Local database:",
+		c.serverLine(),
+		fmt.Sprintf("   Host:     %s:%s", c.localDb.Host, c.localDb.Port),
+		fmt.Sprintf("   Database: %s", c.localDb.Database),
+		fmt.Sprintf("   User:     %s", c.localDb.User),
+		fmt.Sprintf("   Password: %s", c.localDb.Password),
+	}
+
+	remote := []string{" Remote database:"}
+	if conn, err := db.ParseDSN(c.currentEnv.DbDsn); err != nil {
+		remote = append(remote, fmt.Sprintf("   Error parsing DSN: %v", err))
+	} else {
+		remote = append(remote,
+			fmt.Sprintf("   Host:     %s", conn.Host),
+			fmt.Sprintf("   Database: %s", conn.Database),
+		)
+	}
+	if len(c.currentEnv.Schemas) > 0 {
+		remote = append(remote, fmt.Sprintf("   Schemas:  %s", strings.Join(c.currentEnv.Schemas, ", ")))
+	}
+	remote = append(remote, c.filterLines()...)
+
+	// Local and remote databases side by side
+	width, _ := v.Size()
+	column := width / 2
+	for i := 0; i < len(local) || i < len(remote); i++ {
+		var left, right string
+		if i < len(local) {
+			left = local[i]
+		}
+		if i < len(remote) {
+			right = remote[i]
+		}
+		fmt.Fprintf(v, "%-*s%s\n", column, left, right)
 	}
+}
 
-	fmt.Fprintf(v, "   Host:     %s\n", remote.Host)
-	fmt.Fprintf(v, "   Database: %s\n", remote.Database)
+// serverLine describes the local server of the current environment
+func (c *ConnectionView) serverLine() string {
+	local := c.cfg.GetLocal(c.currentEnv)
+	if local.IsNative() {
+		return "   Server:   native"
+	}
+
+	runtime := local.Runtime
+	if runtime == "" {
+		runtime = "auto"
+	}
+	return fmt.Sprintf("   Server:   %s (%s, %s)", local.ContainerName, local.Image, runtime)
+}
+
+// filterLines describes active table filters of the current environment
+func (c *ConnectionView) filterLines() []string {
+	if !c.currentEnv.HasTableFilters() {
+		return nil
+	}
+
+	var lines []string
+	if len(c.currentEnv.IncludeTables) > 0 {
+		lines = append(lines, fmt.Sprintf("   Include:  %s", strings.Join(c.currentEnv.IncludeTables, ", ")))
+	}
+	if len(c.currentEnv.ExcludeTables) > 0 {
+		lines = append(lines, fmt.Sprintf("   Exclude:  %s", strings.Join(c.currentEnv.ExcludeTables, ", ")))
+	}
+	if len(c.currentEnv.ExcludeTableData) > 0 {
+		lines = append(lines, fmt.Sprintf("   No data:  %s", strings.Join(c.currentEnv.ExcludeTableData, ", ")))
+	}
+	return lines
 }
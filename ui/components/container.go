@@ -0,0 +1,262 @@
+package components
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jroimartin/gocui"
+
+	"dumper/catalog"
+	"dumper/config/env"
+	"dumper/database"
+	"dumper/ui/theme"
+	"dumper/ui/views"
+)
+
+// statusInterval limits how often the container status is read, reading it calls
+// the container runtime and measures the data directory inside the container
+const statusInterval = 2 * time.Second
+
+// ContainerView shows the local database container and manages its lifecycle
+type ContainerView struct {
+	gui           *gocui.Gui
+	showContainer bool
+	needUpdate    bool                     // status has to be read again
+	needRender    bool                     // view content is out of date
+	confirm       database.ContainerAction // action waiting for confirmation
+	environment   func() *env.Environment
+	status        func(e *env.Environment) (database.ContainerStatus, error)
+	onAction      func(action database.ContainerAction) error
+	onLog         func(string, ...interface{})
+
+	// Status is read in the background, these are only touched in the main loop
+	loading   bool
+	stale     bool // status was requested again while loading
+	loaded    bool
+	readAt    time.Time
+	current   database.ContainerStatus
+	statusErr error
+}
+
+// NewContainerView creates a new container panel component.
+// The status of the current environment's container is read in a goroutine.
+func NewContainerView(g *gocui.Gui, environment func() *env.Environment,
+	status func(e *env.Environment) (database.ContainerStatus, error),
+	onAction func(action database.ContainerAction) error, onLog func(string, ...interface{})) *ContainerView {
+	return &ContainerView{
+		gui:         g,
+		environment: environment,
+		status:      status,
+		onAction:    onAction,
+		onLog:       onLog,
+	}
+}
+
+// Layout implements the views.Component interface
+func (c *ContainerView) Layout(maxX, maxY int) error {
+	if !c.showContainer {
+		return nil
+	}
+
+	width := maxX / 2
+	if width < theme.Dimensions.DialogMinWidth {
+		width = theme.Dimensions.DialogMinWidth
+	}
+	height := maxY * 2 / 3
+	x1 := (maxX - width) / 2
+	y1 := (maxY - height) / 2
+
+	if v, err := c.gui.SetView(views.ContainerView, x1, y1, x1+width, y1+height); err != nil {
+		if err != gocui.ErrUnknownView {
+			return err
+		}
+		v.Frame = true
+		v.Title = " Local container "
+		v.Wrap = true
+
+		if err := c.setupKeybindings(); err != nil {
+			return err
+		}
+
+		c.gui.SetCurrentView(views.ContainerView)
+		c.needUpdate = true
+	}
+
+	if c.needUpdate {
+		c.needUpdate = false
+		c.readStatus()
+	}
+	if v, err := c.gui.View(views.ContainerView); err == nil && c.needRender {
+		c.render(v)
+		c.needRender = false
+	}
+
+	return nil
+}
+
+// readStatus reads the status in a goroutine, at most once per statusInterval,
+// and shows it from the main loop, so a slow runtime doesn't block the UI
+func (c *ContainerView) readStatus() {
+	if c.loading {
+		c.stale = true
+		return
+	}
+	c.loading = true
+
+	e := c.environment()
+	wait := statusInterval - time.Since(c.readAt)
+	go func() {
+		if wait > 0 {
+			time.Sleep(wait)
+		}
+		status, err := c.status(e)
+		c.gui.Update(func(g *gocui.Gui) error {
+			c.loading = false
+			c.readAt = time.Now()
+			c.current, c.statusErr, c.loaded = status, err, true
+			c.needRender = true
+			if c.stale {
+				c.stale = false
+				c.needUpdate = true
+			}
+			return nil
+		})
+	}()
+}
+
+// Show displays the container panel
+func (c *ContainerView) Show() {
+	c.showContainer = true
+	c.loaded = false // the environment may have changed
+	c.needUpdate = true
+	c.needRender = true
+}
+
+// Refresh re-reads the container status on next layout
+func (c *ContainerView) Refresh() {
+	c.needUpdate = true
+}
+
+// Hide hides the container panel
+func (c *ContainerView) Hide() {
+	c.showContainer = false
+	c.confirm = ""
+
+	for _, key := range []interface{}{gocui.KeyEsc, 's', 't', 'r', 'R', 'x', 'y', 'n'} {
+		c.gui.DeleteKeybinding(views.ContainerView, key, gocui.ModNone)
+	}
+	c.gui.DeleteView(views.ContainerView)
+	c.gui.SetCurrentView(views.MigrationsView)
+}
+
+// IsVisible reports whether the container panel is shown
+func (c *ContainerView) IsVisible() bool {
+	return c.showContainer
+}
+
+func (c *ContainerView) setupKeybindings() error {
+	bindings := []struct {
+		key     interface{}
+		handler func(*gocui.Gui, *gocui.View) error
+	}{
+		{gocui.KeyEsc, c.close},
+		{'s', c.action(database.ContainerStart)},
+		{'t', c.action(database.ContainerStop)},
+		{'r', c.action(database.ContainerRestart)},
+		{'R', c.ask(database.ContainerRecreate)},
+		{'x', c.ask(database.ContainerDestroy)},
+		{'y', c.confirmAction},
+		{'n', c.cancelAction},
+	}
+
+	for _, b := range bindings {
+		if err := c.gui.SetKeybinding(views.ContainerView, b.key, gocui.ModNone, b.handler); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *ContainerView) render(v *gocui.View) {
+	v.Clear()
+
+	status, err := c.current, c.statusErr
+	if !c.loaded {
+		fmt.Fprintln(v, " Reading container status...")
+	} else if err != nil {
+		fmt.Fprintf(v, " Error: %v\n", err)
+	} else {
+		fmt.Fprintf(v, " Container:  %s (%s)\n", status.Name, status.State)
+		fmt.Fprintf(v, " Image:      %s\n", status.Image)
+		fmt.Fprintf(v, " Port:       %d\n", status.Port)
+		fmt.Fprintf(v, " Volume:     %s\n", status.Volume)
+		if status.DiskUsage >= 0 {
+			fmt.Fprintf(v, " Disk usage: %s\n", catalog.FormatSize(status.DiskUsage))
+		}
+		if len(status.Databases) > 0 {
+			fmt.Fprintln(v, "\n Databases:")
+			for _, db := range status.Databases {
+				fmt.Fprintf(v, "   %-24s %10s\n", db.Name, catalog.FormatSize(db.Size))
+			}
+		}
+	}
+
+	fmt.Fprintln(v)
+	switch c.confirm {
+	case database.ContainerRecreate:
+		fmt.Fprintln(v, " Recreate the container? Data in the volume is kept. y - yes | n - no")
+	case database.ContainerDestroy:
+		fmt.Fprintln(v, " Destroy the container and its volume with all databases? y - yes | n - no")
+	default:
+		fmt.Fprintln(v, " s - start | t - stop | r - restart | R - recreate | x - destroy | Esc - close")
+	}
+}
+
+func (c *ContainerView) close(g *gocui.Gui, v *gocui.View) error {
+	c.Hide()
+	return nil
+}
+
+// action returns a handler running the action right away
+func (c *ContainerView) action(action database.ContainerAction) func(*gocui.Gui, *gocui.View) error {
+	return func(g *gocui.Gui, v *gocui.View) error {
+		c.confirm = ""
+		c.run(action)
+		return nil
+	}
+}
+
+// ask returns a handler asking to confirm the action first
+func (c *ContainerView) ask(action database.ContainerAction) func(*gocui.Gui, *gocui.View) error {
+	return func(g *gocui.Gui, v *gocui.View) error {
+		c.confirm = action
+		c.needRender = true
+		return nil
+	}
+}
+
+func (c *ContainerView) confirmAction(g *gocui.Gui, v *gocui.View) error {
+	if c.confirm == "" {
+		return nil
+	}
+	action := c.confirm
+	c.confirm = ""
+	c.run(action)
+	return nil
+}
+
+func (c *ContainerView) cancelAction(g *gocui.Gui, v *gocui.View) error {
+	if c.confirm != "" {
+		c.confirm = ""
+		c.needRender = true
+	}
+	return nil
+}
+
+func (c *ContainerView) run(action database.ContainerAction) {
+	c.needUpdate = true
+	c.needRender = true
+	if err := c.onAction(action); err != nil {
+		c.onLog("Error: %v", err)
+	}
+}
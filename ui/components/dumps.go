@@ -0,0 +1,363 @@
+package components
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jroimartin/gocui"
+
+	"dumper/catalog"
+	"dumper/config/env"
+	"dumper/ui/theme"
+	"dumper/ui/views"
+)
+
+// DumpsView represents the dump browser for the current environment
+type DumpsView struct {
+	gui           *gocui.Gui
+	catalog       *catalog.Catalog
+	currentEnv    *env.Environment
+	dumps         []catalog.Entry
+	showDumps     bool
+	needUpdate    bool
+	confirmDelete bool
+	onLoad        func(dumpID string)
+	onLog         func(string, ...interface{})
+}
+
+// NewDumpsView creates a new dump browser component
+func NewDumpsView(g *gocui.Gui, dumps *catalog.Catalog, onLoad func(dumpID string), onLog func(string, ...interface{})) *DumpsView {
+	return &DumpsView{
+		gui:     g,
+		catalog: dumps,
+		onLoad:  onLoad,
+		onLog:   onLog,
+	}
+}
+
+// Layout implements the views.Component interface
+func (d *DumpsView) Layout(maxX, maxY int) error {
+	if !d.showDumps {
+		return nil
+	}
+
+	width := maxX * 3 / 4
+	if width < theme.Dimensions.DialogMinWidth {
+		width = theme.Dimensions.DialogMinWidth
+	}
+	height := maxY * 2 / 3
+	x1 := (maxX - width) / 2
+	y1 := (maxY - height) / 2
+
+	if v, err := d.gui.SetView(views.DumpsView, x1, y1, x1+width, y1+height); err != nil {
+		if err != gocui.ErrUnknownView {
+			return err
+		}
+		v.Frame = true
+		v.Title = fmt.Sprintf(" Dumps: %s ", d.getCurrentEnvName())
+		v.Highlight = true
+		v.SelBgColor = theme.Colors.SelectionBg
+		v.SelFgColor = theme.Colors.SelectionFg
+
+		if err := d.setupKeybindings(); err != nil {
+			return err
+		}
+
+		d.gui.SetCurrentView(views.DumpsView)
+		v.SetCursor(0, 0)
+		d.needUpdate = true
+	}
+
+	if v, err := d.gui.View(views.DumpsView); err == nil && d.needUpdate {
+		d.updateDumpsList(v)
+		d.needUpdate = false
+	}
+
+	return nil
+}
+
+// SetCurrentEnvironment updates the environment whose dumps are shown
+func (d *DumpsView) SetCurrentEnvironment(env *env.Environment) {
+	d.currentEnv = env
+	d.needUpdate = true
+}
+
+// Refresh re-reads the dump catalog on next layout
+func (d *DumpsView) Refresh() {
+	d.needUpdate = true
+}
+
+// Show displays the dump browser
+func (d *DumpsView) Show() {
+	d.showDumps = true
+	d.needUpdate = true
+}
+
+// Hide hides the dump browser
+func (d *DumpsView) Hide() {
+	d.showDumps = false
+	d.confirmDelete = false
+	d.closeRenameDialog()
+
+	for _, key := range []interface{}{gocui.KeyArrowUp, gocui.KeyArrowDown, gocui.KeyEnter, gocui.KeyEsc, gocui.KeyDelete, 'x', 'r', 'p', 'y', 'n'} {
+		d.gui.DeleteKeybinding(views.DumpsView, key, gocui.ModNone)
+	}
+	d.gui.DeleteView(views.DumpsView)
+	d.gui.SetCurrentView(views.MigrationsView)
+}
+
+// IsVisible reports whether the dump browser is shown
+func (d *DumpsView) IsVisible() bool {
+	return d.showDumps
+}
+
+func (d *DumpsView) getCurrentEnvName() string {
+	if d.currentEnv != nil {
+		return d.currentEnv.Name
+	}
+	return "not selected"
+}
+
+func (d *DumpsView) setupKeybindings() error {
+	bindings := []struct {
+		key     interface{}
+		handler func(*gocui.Gui, *gocui.View) error
+	}{
+		{gocui.KeyArrowUp, d.up},
+		{gocui.KeyArrowDown, d.down},
+		{gocui.KeyEnter, d.load},
+		{gocui.KeyEsc, d.close},
+		{gocui.KeyDelete, d.askDelete},
+		{'x', d.askDelete},
+		{'y', d.confirmDeleteDump},
+		{'n', d.cancelDelete},
+		{'r', d.showRenameDialog},
+		{'p', d.togglePin},
+	}
+
+	for _, b := range bindings {
+		if err := d.gui.SetKeybinding(views.DumpsView, b.key, gocui.ModNone, b.handler); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *DumpsView) updateDumpsList(v *gocui.View) {
+	v.Clear()
+	v.Title = fmt.Sprintf(" Dumps: %s ", d.getCurrentEnvName())
+
+	d.dumps = nil
+	if d.currentEnv != nil {
+		var err error
+		d.dumps, err = d.catalog.List(d.currentEnv.Name)
+		if err != nil {
+			fmt.Fprintf(v, " Error reading dump catalog: %v\n", err)
+			return
+		}
+	}
+
+	if len(d.dumps) == 0 {
+		fmt.Fprintln(v, " No dumps found")
+	}
+
+	for _, e := range d.dumps {
+		pin := " "
+		if e.Pinned {
+			pin = "P"
+		}
+		fmt.Fprintf(v, " [%s] %s  %-10s %10s  %s\n",
+			pin, e.CreatedAt.Format("2006-01-02 15:04:05"), e.FormatName(), catalog.FormatSize(e.Size), e.Name())
+	}
+
+	fmt.Fprintln(v)
+	if d.confirmDelete {
+		if e, ok := d.selected(v); ok {
+			fmt.Fprintf(v, " Delete %s? y - yes | n - no\n", e.Name())
+			return
+		}
+	}
+	fmt.Fprintln(v, " Enter - load | r - rename | p - pin/unpin | x - delete | Esc - close")
+
+	// Keep cursor inside the list after removals
+	if _, cy := v.Cursor(); len(d.dumps) > 0 && cy >= len(d.dumps) {
+		v.SetCursor(0, len(d.dumps)-1)
+	}
+}
+
+// selected returns the dump under the cursor
+func (d *DumpsView) selected(v *gocui.View) (catalog.Entry, bool) {
+	_, cy := v.Cursor()
+	_, oy := v.Origin()
+	i := cy + oy
+	if i < 0 || i >= len(d.dumps) {
+		return catalog.Entry{}, false
+	}
+	return d.dumps[i], true
+}
+
+func (d *DumpsView) up(g *gocui.Gui, v *gocui.View) error {
+	_, cy := v.Cursor()
+	if cy > 0 {
+		v.SetCursor(0, cy-1)
+	} else if ox, oy := v.Origin(); oy > 0 {
+		v.SetOrigin(ox, oy-1)
+	}
+	d.cancelDelete(g, v)
+	return nil
+}
+
+func (d *DumpsView) down(g *gocui.Gui, v *gocui.View) error {
+	_, cy := v.Cursor()
+	_, oy := v.Origin()
+	if cy+oy >= len(d.dumps)-1 {
+		return nil
+	}
+	if err := v.SetCursor(0, cy+1); err != nil {
+		ox, oy := v.Origin()
+		v.SetOrigin(ox, oy+1)
+	}
+	d.cancelDelete(g, v)
+	return nil
+}
+
+func (d *DumpsView) close(g *gocui.Gui, v *gocui.View) error {
+	d.Hide()
+	return nil
+}
+
+func (d *DumpsView) load(g *gocui.Gui, v *gocui.View) error {
+	e, ok := d.selected(v)
+	if !ok {
+		return nil
+	}
+
+	d.Hide()
+	if d.onLoad != nil {
+		d.onLoad(e.ID)
+	}
+	return nil
+}
+
+func (d *DumpsView) askDelete(g *gocui.Gui, v *gocui.View) error {
+	if _, ok := d.selected(v); !ok {
+		return nil
+	}
+	d.confirmDelete = true
+	d.needUpdate = true
+	return nil
+}
+
+func (d *DumpsView) cancelDelete(g *gocui.Gui, v *gocui.View) error {
+	if d.confirmDelete {
+		d.confirmDelete = false
+		d.needUpdate = true
+	}
+	return nil
+}
+
+func (d *DumpsView) confirmDeleteDump(g *gocui.Gui, v *gocui.View) error {
+	if !d.confirmDelete {
+		return nil
+	}
+	d.confirmDelete = false
+	d.needUpdate = true
+
+	e, ok := d.selected(v)
+	if !ok {
+		return nil
+	}
+
+	if err := d.catalog.Remove(e.ID); err != nil {
+		d.onLog("Error deleting dump: %v", err)
+		return nil
+	}
+	d.onLog("Deleted dump %s", e.Name())
+	return nil
+}
+
+func (d *DumpsView) togglePin(g *gocui.Gui, v *gocui.View) error {
+	e, ok := d.selected(v)
+	if !ok {
+		return nil
+	}
+
+	if err := d.catalog.SetPinned(e.ID, !e.Pinned); err != nil {
+		d.onLog("Error pinning dump: %v", err)
+		return nil
+	}
+
+	if e.Pinned {
+		d.onLog("Unpinned dump %s", e.Name())
+	} else {
+		d.onLog("Pinned dump %s", e.Name())
+	}
+	d.needUpdate = true
+	return nil
+}
+
+// Rename dialog methods
+func (d *DumpsView) showRenameDialog(g *gocui.Gui, v *gocui.View) error {
+	e, ok := d.selected(v)
+	if !ok {
+		return nil
+	}
+
+	maxX, maxY := g.Size()
+	width := theme.Dimensions.DialogMinWidth
+	x1 := (maxX - width) / 2
+	y1 := maxY/2 - 1
+
+	rv, err := g.SetView(views.DumpRenameView, x1, y1, x1+width, y1+2)
+	if err != nil && err != gocui.ErrUnknownView {
+		return err
+	}
+	rv.Title = " Rename dump (Enter - save, Esc - cancel) "
+	rv.Frame = true
+	rv.Editable = true
+	rv.Clear()
+	fmt.Fprint(rv, e.Label)
+	rv.SetCursor(len(e.Label), 0)
+
+	if err := g.SetKeybinding(views.DumpRenameView, gocui.KeyEnter, gocui.ModNone,
+		func(g *gocui.Gui, rv *gocui.View) error {
+			label := strings.TrimSpace(rv.Buffer())
+			d.closeRenameDialog()
+			if err := d.catalog.Rename(e.ID, label); err != nil {
+				d.onLog("Error renaming dump: %v", err)
+				return nil
+			}
+			d.onLog("Renamed dump %s to %q", e.ID, label)
+			d.needUpdate = true
+			return nil
+		}); err != nil {
+		return err
+	}
+
+	if err := g.SetKeybinding(views.DumpRenameView, gocui.KeyEsc, gocui.ModNone,
+		func(g *gocui.Gui, rv *gocui.View) error {
+			d.closeRenameDialog()
+			return nil
+		}); err != nil {
+		return err
+	}
+
+	g.Cursor = true
+	_, err = g.SetCurrentView(views.DumpRenameView)
+	return err
+}
+
+func (d *DumpsView) closeRenameDialog() {
+	if _, err := d.gui.View(views.DumpRenameView); err != nil {
+		return
+	}
+
+	d.gui.DeleteKeybinding(views.DumpRenameView, gocui.KeyEnter, gocui.ModNone)
+	d.gui.DeleteKeybinding(views.DumpRenameView, gocui.KeyEsc, gocui.ModNone)
+	d.gui.DeleteView(views.DumpRenameView)
+	d.gui.Cursor = false
+
+	if d.showDumps {
+		d.gui.SetCurrentView(views.DumpsView)
+	}
+}
@@ -0,0 +1,199 @@
+package components
+
+import (
+	"fmt"
+
+	"github.com/jroimartin/gocui"
+
+	"dumper/jobs"
+	"dumper/ui/theme"
+	"dumper/ui/views"
+)
+
+// JobsView lists queued, running and finished jobs with the log of the selected one
+type JobsView struct {
+	gui      *gocui.Gui
+	queue    *jobs.Queue
+	showJobs bool
+	selected int // index of the selected job
+	onLog    func(string, ...interface{})
+}
+
+// NewJobsView creates a new jobs panel component
+func NewJobsView(g *gocui.Gui, queue *jobs.Queue, onLog func(string, ...interface{})) *JobsView {
+	return &JobsView{
+		gui:   g,
+		queue: queue,
+		onLog: onLog,
+	}
+}
+
+// Layout implements the views.Component interface
+func (j *JobsView) Layout(maxX, maxY int) error {
+	if !j.showJobs {
+		return nil
+	}
+
+	width := maxX * 3 / 4
+	if width < theme.Dimensions.DialogMinWidth {
+		width = theme.Dimensions.DialogMinWidth
+	}
+	height := maxY * 2 / 3
+	x1 := (maxX - width) / 2
+	y1 := (maxY - height) / 2
+
+	v, err := j.gui.SetView(views.JobsView, x1, y1, x1+width, y1+height)
+	if err != nil {
+		if err != gocui.ErrUnknownView {
+			return err
+		}
+		v.Frame = true
+		v.Title = " Jobs "
+		v.Highlight = true
+		v.SelBgColor = theme.Colors.SelectionBg
+		v.SelFgColor = theme.Colors.SelectionFg
+
+		if err := j.setupKeybindings(); err != nil {
+			return err
+		}
+
+		j.gui.SetCurrentView(views.JobsView)
+	}
+
+	// Durations of running jobs change, so the list is drawn on every layout
+	j.render(v)
+	return nil
+}
+
+// Show displays the jobs panel
+func (j *JobsView) Show() {
+	j.showJobs = true
+}
+
+// Hide hides the jobs panel
+func (j *JobsView) Hide() {
+	j.showJobs = false
+
+	for _, key := range []interface{}{gocui.KeyArrowUp, gocui.KeyArrowDown, gocui.KeyEsc, 'x', 'C'} {
+		j.gui.DeleteKeybinding(views.JobsView, key, gocui.ModNone)
+	}
+	j.gui.DeleteView(views.JobsView)
+	j.gui.SetCurrentView(views.MigrationsView)
+}
+
+// IsVisible reports whether the jobs panel is shown
+func (j *JobsView) IsVisible() bool {
+	return j.showJobs
+}
+
+func (j *JobsView) setupKeybindings() error {
+	bindings := []struct {
+		key     interface{}
+		handler func(*gocui.Gui, *gocui.View) error
+	}{
+		{gocui.KeyArrowUp, j.up},
+		{gocui.KeyArrowDown, j.down},
+		{gocui.KeyEsc, j.close},
+		{'x', j.cancel},
+		{'C', j.clear},
+	}
+
+	for _, b := range bindings {
+		if err := j.gui.SetKeybinding(views.JobsView, b.key, gocui.ModNone, b.handler); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (j *JobsView) render(v *gocui.View) {
+	v.Clear()
+	_, height := v.Size()
+
+	list := j.queue.Jobs()
+	if len(list) == 0 {
+		fmt.Fprintln(v, " No jobs")
+	}
+	if j.selected >= len(list) {
+		j.selected = len(list) - 1
+	}
+	if j.selected < 0 {
+		j.selected = 0
+	}
+
+	for _, job := range list {
+		duration := "-"
+		if d := job.Duration(); d > 0 {
+			duration = formatDuration(d)
+		}
+		fmt.Fprintf(v, " #%-3d %-32s %-8s %8s\n", job.ID, job.Name, job.State(), duration)
+	}
+	v.SetOrigin(0, 0)
+	v.SetCursor(0, j.selected)
+
+	if len(list) > 0 {
+		job := list[j.selected]
+		fmt.Fprintf(v, "\n Log of #%d:\n", job.ID)
+
+		// Only the latest lines that fit above the help line
+		logs := job.Logs()
+		room := height - len(list) - 5
+		if room < 1 {
+			room = 1
+		}
+		if len(logs) > room {
+			logs = logs[len(logs)-room:]
+		}
+		for _, line := range logs {
+			fmt.Fprintf(v, "   %s\n", line)
+		}
+	}
+
+	fmt.Fprintln(v)
+	fmt.Fprintln(v, " x - cancel | C - clear finished | Esc - close")
+}
+
+// selectedJob returns the job under the cursor
+func (j *JobsView) selectedJob() (*jobs.Job, bool) {
+	list := j.queue.Jobs()
+	if j.selected < 0 || j.selected >= len(list) {
+		return nil, false
+	}
+	return list[j.selected], true
+}
+
+func (j *JobsView) up(g *gocui.Gui, v *gocui.View) error {
+	if j.selected > 0 {
+		j.selected--
+	}
+	return nil
+}
+
+func (j *JobsView) down(g *gocui.Gui, v *gocui.View) error {
+	if j.selected < len(j.queue.Jobs())-1 {
+		j.selected++
+	}
+	return nil
+}
+
+func (j *JobsView) close(g *gocui.Gui, v *gocui.View) error {
+	j.Hide()
+	return nil
+}
+
+func (j *JobsView) cancel(g *gocui.Gui, v *gocui.View) error {
+	job, ok := j.selectedJob()
+	if !ok {
+		return nil
+	}
+	if j.queue.Cancel(job) {
+		j.onLog("Cancelling job #%d %s...", job.ID, job.Name)
+	}
+	return nil
+}
+
+func (j *JobsView) clear(g *gocui.Gui, v *gocui.View) error {
+	j.queue.ClearFinished()
+	j.selected = 0
+	return nil
+}
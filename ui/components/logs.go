@@ -2,6 +2,7 @@ package components
 
 import (
 	"fmt"
+	"sync"
 
 	"github.com/jroimartin/gocui"
 
@@ -12,6 +13,7 @@ import (
 // LogsView represents the logs display component
 type LogsView struct {
 	gui        *gocui.Gui
+	mu         sync.Mutex
 	logs       []string
 	needUpdate bool
 }
@@ -39,6 +41,8 @@ func (l *LogsView) Layout(maxX, maxY int) error {
 	}
 
 	// Update logs content only when needed
+	l.mu.Lock()
+	defer l.mu.Unlock()
 	if l.needUpdate {
 		l.updateContent()
 		l.needUpdate = false
@@ -46,14 +50,17 @@ func (l *LogsView) Layout(maxX, maxY int) error {
 	return nil
 }
 
-// AddLog adds a new log message to the list
+// AddLog adds a new log message to the list.
+// It is safe to call from background operations, the view is redrawn in the main loop.
 func (l *LogsView) AddLog(format string, a ...interface{}) {
 	log := fmt.Sprintf(format, a...)
+
+	l.mu.Lock()
 	l.logs = append(l.logs, log)
+	l.needUpdate = true
+	l.mu.Unlock()
 
-	// Обновляем содержимое сразу и помечаем, что обновление не требуется
-	l.updateContent()
-	l.needUpdate = false
+	l.gui.Update(func(g *gocui.Gui) error { return nil })
 }
 
 // updateContent updates the view content without using gui.Update
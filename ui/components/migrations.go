@@ -28,15 +28,17 @@ type MigrationsView struct {
 	onLog       func(string, ...interface{}) // logging function
 	localDb     *db.Connection
 	isMigrating bool
+	onMigrate   func(targetVersion int64) // runs the migration in the background
 }
 
 // NewMigrationsView creates a new migrations view component
-func NewMigrationsView(g *gocui.Gui, localDb *db.Connection, onLog func(string, ...interface{})) *MigrationsView {
+func NewMigrationsView(g *gocui.Gui, localDb *db.Connection, onMigrate func(targetVersion int64), onLog func(string, ...interface{})) *MigrationsView {
 	return &MigrationsView{
 		gui:        g,
 		needUpdate: true,
 		onLog:      onLog,
 		localDb:    localDb,
+		onMigrate:  onMigrate,
 	}
 }
 
@@ -431,28 +433,22 @@ func (m *MigrationsView) confirmMigration(targetVersion int64) error {
 		return nil
 	})
 
-	// Запускаем миграцию в отдельной горутине
-	go func() {
-		if err := migrations.MigrateTo(m.localDb.GetDSN(), m.currentEnv.MigrationsDir, targetVersion, m.onLog); err != nil {
-			m.onLog("Migration error: %v", err)
-		} else {
-			m.onLog("Migration completed successfully!")
-		}
-
-		// Сбрасываем флаг миграции и обновляем UI
-		m.isMigrating = false
-		m.needUpdate = true
-		m.gui.Update(func(g *gocui.Gui) error {
-			if v, err := g.View(migrationsView); err == nil {
-				return m.updateMigrationsList(v)
-			}
-			return nil
-		})
-	}()
+	m.onMigrate(targetVersion)
 
 	return nil
 }
 
+// Refresh re-reads migration status of the local database on next layout
+func (m *MigrationsView) Refresh() {
+	m.needUpdate = true
+}
+
+// SetMigrating shows that a migration is running or has finished, refreshing the list after it
+func (m *MigrationsView) SetMigrating(migrating bool) {
+	m.isMigrating = migrating
+	m.needUpdate = true
+}
+
 func (m *MigrationsView) closeConfirmDialog(g *gocui.Gui, v *gocui.View) error {
 	// Delete keybindings first
 	g.DeleteKeybinding("", 'y', gocui.ModNone)
@@ -0,0 +1,109 @@
+package components
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jroimartin/gocui"
+
+	"dumper/catalog"
+	"dumper/database"
+	"dumper/ui/theme"
+	"dumper/ui/views"
+)
+
+// progressHeight is the height of the progress panel including its frame
+const progressHeight = 7
+
+// ProgressView shows progress of a running dump or load
+type ProgressView struct {
+	gui      *gocui.Gui
+	title    string
+	progress *database.Progress
+}
+
+// NewProgressView creates a new progress panel component
+func NewProgressView(g *gocui.Gui) *ProgressView {
+	return &ProgressView{gui: g}
+}
+
+// Layout implements the views.Component interface
+func (p *ProgressView) Layout(maxX, maxY int) error {
+	if p.progress == nil {
+		return nil
+	}
+
+	// Over the bottom of the migrations panel, so that logs stay visible
+	width := maxX * 2 / 3
+	y1 := maxY - theme.Dimensions.CommandHeight - 1 - progressHeight
+	v, err := p.gui.SetView(views.ProgressView, 0, y1, width, y1+progressHeight)
+	if err != nil {
+		if err != gocui.ErrUnknownView {
+			return err
+		}
+		v.Frame = true
+	}
+
+	v.Title = fmt.Sprintf(" %s ", p.title)
+	v.Clear()
+	p.render(v, p.progress.State())
+	return nil
+}
+
+// Show displays progress of the operation until Hide is called
+func (p *ProgressView) Show(title string, progress *database.Progress) {
+	p.title = title
+	p.progress = progress
+}
+
+// Hide removes the progress panel
+func (p *ProgressView) Hide() {
+	p.progress = nil
+	p.gui.DeleteView(views.ProgressView)
+}
+
+func (p *ProgressView) render(v *gocui.View, state database.ProgressState) {
+	width, _ := v.Size()
+
+	fmt.Fprintf(v, " Stage:    %s\n", state.Stage)
+
+	done := catalog.FormatSize(state.Bytes)
+	if state.Total > 0 {
+		ratio := float64(state.Bytes) / float64(state.Total)
+		if ratio > 1 {
+			ratio = 1
+		}
+		line := fmt.Sprintf(" Size:     %s of ~%s %3.0f%% ", done, catalog.FormatSize(state.Total), ratio*100)
+		fmt.Fprintf(v, "%s%s\n", line, progressBar(width-len(line)-1, ratio))
+	} else {
+		fmt.Fprintf(v, " Size:     %s\n", done)
+	}
+
+	table := state.Table
+	if state.TotalTables > 0 {
+		table = fmt.Sprintf("%s (%d/%d)", table, state.Tables, state.TotalTables)
+	}
+	fmt.Fprintf(v, " Table:    %s\n", strings.TrimSpace(table))
+
+	eta := "-"
+	if state.ETA > 0 {
+		eta = formatDuration(state.ETA)
+	}
+	fmt.Fprintf(v, " Elapsed:  %s\n", formatDuration(state.Elapsed))
+	fmt.Fprintf(v, " ETA:      %s\n", eta)
+}
+
+// progressBar draws a bar of the given width filled to ratio
+func progressBar(width int, ratio float64) string {
+	if width < 3 {
+		return ""
+	}
+	filled := int(float64(width-2) * ratio)
+	return "[" + strings.Repeat("#", filled) + strings.Repeat(".", width-2-filled) + "]"
+}
+
+// formatDuration formats a duration rounded to seconds, e.g. "2m10s"
+func formatDuration(d time.Duration) string {
+	return d.Round(time.Second).String()
+}
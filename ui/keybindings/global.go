@@ -6,11 +6,17 @@ import (
 
 // GlobalKeybindings contains all global key bindings
 type GlobalKeybindings struct {
-	gui     *gocui.Gui
-	onQuit  func() error
-	onDump  func() error
-	onLoad  func() error
-	onSpace func() error
+	gui         *gocui.Gui
+	onQuit      func() error
+	onDump      func() error
+	onLoad      func() error
+	onCopy      func() error
+	onRefresh   func() error
+	onSpace     func() error
+	onBrowse    func() error
+	onContainer func() error
+	onJobs      func() error
+	onAbort     func() error
 }
 
 // NewGlobalKeybindings creates a new global keybindings handler
@@ -19,14 +25,26 @@ func NewGlobalKeybindings(
 	onQuit func() error,
 	onDump func() error,
 	onLoad func() error,
+	onCopy func() error,
+	onRefresh func() error,
 	onSpace func() error,
+	onBrowse func() error,
+	onContainer func() error,
+	onJobs func() error,
+	onAbort func() error,
 ) *GlobalKeybindings {
 	return &GlobalKeybindings{
-		gui:     gui,
-		onQuit:  onQuit,
-		onDump:  onDump,
-		onLoad:  onLoad,
-		onSpace: onSpace,
+		gui:         gui,
+		onQuit:      onQuit,
+		onDump:      onDump,
+		onLoad:      onLoad,
+		onCopy:      onCopy,
+		onRefresh:   onRefresh,
+		onSpace:     onSpace,
+		onBrowse:    onBrowse,
+		onContainer: onContainer,
+		onJobs:      onJobs,
+		onAbort:     onAbort,
 	}
 }
 
@@ -38,27 +56,90 @@ func (k *GlobalKeybindings) Setup() error {
 		if err := k.gui.SetKeybinding(view, gocui.KeyCtrlC, gocui.ModNone, k.quit); err != nil {
 			return err
 		}
-		if err := k.gui.SetKeybinding(view, 'q', gocui.ModNone, k.quit); err != nil {
+		if err := k.gui.SetKeybinding(view, 'q', gocui.ModNone, k.typeable('q', k.quit)); err != nil {
 			return err
 		}
 	}
 
-	// Global commands - only for empty view
-	if err := k.gui.SetKeybinding("", 'd', gocui.ModNone, k.dump); err != nil {
+	// Global commands - only from the main screen, so that typing in a dialog,
+	// e.g. a dump label, doesn't start them
+	if err := k.gui.SetKeybinding("", 'd', gocui.ModNone, k.typeable('d', k.mainViewOnly(k.dump))); err != nil {
 		return err
 	}
 
-	if err := k.gui.SetKeybinding("", 'l', gocui.ModNone, k.load); err != nil {
+	if err := k.gui.SetKeybinding("", 'l', gocui.ModNone, k.typeable('l', k.mainViewOnly(k.load))); err != nil {
 		return err
 	}
 
-	if err := k.gui.SetKeybinding("", gocui.KeySpace, gocui.ModNone, k.showEnvironments); err != nil {
+	// The dump browser uses 'p' to pin a dump
+	if err := k.gui.SetKeybinding("", 'p', gocui.ModNone, k.typeable('p', k.mainViewOnly(k.copy))); err != nil {
+		return err
+	}
+
+	// Dialogs use 'r' themselves, e.g. to rename a dump
+	if err := k.gui.SetKeybinding("", 'r', gocui.ModNone, k.typeable('r', k.mainViewOnly(k.refresh))); err != nil {
+		return err
+	}
+
+	if err := k.gui.SetKeybinding("", 'b', gocui.ModNone, k.typeable('b', k.mainViewOnly(k.browse))); err != nil {
+		return err
+	}
+
+	if err := k.gui.SetKeybinding("", 'c', gocui.ModNone, k.typeable('c', k.mainViewOnly(k.container))); err != nil {
+		return err
+	}
+
+	if err := k.gui.SetKeybinding("", 'j', gocui.ModNone, k.typeable('j', k.mainViewOnly(k.jobs))); err != nil {
+		return err
+	}
+
+	if err := k.gui.SetKeybinding("", gocui.KeySpace, gocui.ModNone, k.typeable(' ', k.showEnvironments)); err != nil {
+		return err
+	}
+
+	// Abort - Ctrl+X anywhere, Esc only where it doesn't close a dialog
+	if err := k.gui.SetKeybinding("", gocui.KeyCtrlX, gocui.ModNone, k.abort); err != nil {
+		return err
+	}
+	if err := k.gui.SetKeybinding("", gocui.KeyEsc, gocui.ModNone, k.mainViewOnly(k.abort)); err != nil {
 		return err
 	}
 
 	return nil
 }
 
+// typeable wraps a handler of a printable key so that the key is typed
+// into editable views (text inputs) instead of triggering the command
+func (k *GlobalKeybindings) typeable(ch rune, handler func(*gocui.Gui, *gocui.View) error) func(*gocui.Gui, *gocui.View) error {
+	return func(g *gocui.Gui, v *gocui.View) error {
+		if v != nil && v.Editable {
+			v.EditWrite(ch)
+			return nil
+		}
+		return handler(g, v)
+	}
+}
+
+// mainViewOnly wraps a handler of a key that dialogs use for themselves,
+// so that the command is triggered only when no dialog has focus
+func (k *GlobalKeybindings) mainViewOnly(handler func(*gocui.Gui, *gocui.View) error) func(*gocui.Gui, *gocui.View) error {
+	return func(g *gocui.Gui, v *gocui.View) error {
+		if v != nil && !mainViews[v.Name()] {
+			return nil
+		}
+		return handler(g, v)
+	}
+}
+
+// mainViews are views of the main screen, other views are dialogs
+var mainViews = map[string]bool{
+	"migrations": true,
+	"connection": true,
+	"status":     true,
+	"commands":   true,
+	"progress":   true,
+}
+
 func (k *GlobalKeybindings) quit(g *gocui.Gui, v *gocui.View) error {
 	// Handle quit
 	return k.onQuit()
@@ -74,7 +155,37 @@ func (k *GlobalKeybindings) load(g *gocui.Gui, v *gocui.View) error {
 	return k.onLoad()
 }
 
+func (k *GlobalKeybindings) copy(g *gocui.Gui, v *gocui.View) error {
+	// Handle copy without a dump file
+	return k.onCopy()
+}
+
+func (k *GlobalKeybindings) refresh(g *gocui.Gui, v *gocui.View) error {
+	// Handle refresh pipeline
+	return k.onRefresh()
+}
+
 func (k *GlobalKeybindings) showEnvironments(g *gocui.Gui, v *gocui.View) error {
 	// Handle show environments
 	return k.onSpace()
 }
+
+func (k *GlobalKeybindings) browse(g *gocui.Gui, v *gocui.View) error {
+	// Handle show dump browser
+	return k.onBrowse()
+}
+
+func (k *GlobalKeybindings) container(g *gocui.Gui, v *gocui.View) error {
+	// Handle show container panel
+	return k.onContainer()
+}
+
+func (k *GlobalKeybindings) jobs(g *gocui.Gui, v *gocui.View) error {
+	// Handle show jobs panel
+	return k.onJobs()
+}
+
+func (k *GlobalKeybindings) abort(g *gocui.Gui, v *gocui.View) error {
+	// Handle abort of the running operation
+	return k.onAbort()
+}
@@ -1,13 +1,19 @@
 package ui
 
 import (
+	"context"
 	"fmt"
+	"time"
 
 	"github.com/jroimartin/gocui"
 
+	"dumper/catalog"
 	"dumper/config/app"
 	"dumper/config/db"
 	"dumper/config/env"
+	"dumper/database"
+	"dumper/jobs"
+	"dumper/migrations"
 	"dumper/ui/components"
 	"dumper/ui/keybindings"
 	"dumper/ui/layout"
@@ -22,52 +28,96 @@ type UI struct {
 	connectionView   *components.ConnectionView
 	migrationsView   *components.MigrationsView
 	environmentsView *components.EnvironmentsView
+	dumpsView        *components.DumpsView
+	containerView    *components.ContainerView
+	progressView     *components.ProgressView
+	jobsView         *components.JobsView
 	cfg              *app.Config
 	localDb          *db.Connection
-	onDump           func() error
-	onLoad           func() error
+	queue            *jobs.Queue
+	onDump           func(ctx context.Context, job *jobs.Job, e *env.Environment) error
+	onLoad           func(ctx context.Context, job *jobs.Job, e *env.Environment, dumpID string) error
+	onCopy           func(ctx context.Context, job *jobs.Job, e *env.Environment) error
+	onRefresh        func(ctx context.Context, job *jobs.Job, e *env.Environment) error
+	onContainer      func(job *jobs.Job, e *env.Environment, action database.ContainerAction) error
+	progressJob      *jobs.Job // job shown in the progress panel, only accessed in the main loop
+	ticking          bool      // the UI is redrawn while jobs run, only accessed in the main loop
 }
 
-// New creates a new UI instance
-func New(cfg *app.Config, localDb *db.Connection, onDump, onLoad func() error) (*UI, error) {
+// commandsHelp is the text of the commands bar
+const commandsHelp = " Space - Select Environment | d - Dump Database | l - Load Database | p - Copy | r - Refresh | b - Browse Dumps | c - Container | j - Jobs | Esc/Ctrl+X - Abort | q/Ctrl+C - Quit"
+
+// New creates a new UI instance.
+// onDump, onLoad, onCopy, onRefresh and onContainerAction run as background jobs, logging to the job
+// and reporting to its progress. ctx is cancelled on abort.
+// onLoad receives ID of the dump to load, empty ID means the latest dump.
+// onCopy streams the environment's database into the local one without a dump file.
+// onRefresh runs the refresh pipeline: dump, load, migrate and verify by default.
+// containerStatus reports the local container of the environment, it is called in a goroutine.
+func New(cfg *app.Config, localDb *db.Connection, dumps *catalog.Catalog,
+	onDump func(ctx context.Context, job *jobs.Job, e *env.Environment) error,
+	onLoad func(ctx context.Context, job *jobs.Job, e *env.Environment, dumpID string) error,
+	onCopy func(ctx context.Context, job *jobs.Job, e *env.Environment) error,
+	onRefresh func(ctx context.Context, job *jobs.Job, e *env.Environment) error,
+	containerStatus func(e *env.Environment) (database.ContainerStatus, error),
+	onContainerAction func(job *jobs.Job, e *env.Environment, action database.ContainerAction) error) (*UI, error) {
 	gui, err := gocui.NewGui(gocui.OutputNormal)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create GUI: %w", err)
 	}
 
 	ui := &UI{
-		gui:     gui,
-		cfg:     cfg,
-		localDb: localDb,
-		onDump:  onDump,
-		onLoad:  onLoad,
+		gui:         gui,
+		cfg:         cfg,
+		localDb:     localDb,
+		onDump:      onDump,
+		onLoad:      onLoad,
+		onCopy:      onCopy,
+		onRefresh:   onRefresh,
+		onContainer: onContainerAction,
 	}
 
 	// Initialize layout and components FIRST
 	ui.mainLayout = layout.NewMainLayout(gui)
 	ui.logsView = components.NewLogsView(gui)
-	ui.connectionView = components.NewConnectionView(gui, localDb)
-	ui.migrationsView = components.NewMigrationsView(gui, localDb, ui.logsView.AddLog)
+	ui.queue = jobs.NewQueue(ui.logsView.AddLog, ui.onJobChanged)
+	ui.connectionView = components.NewConnectionView(gui, cfg, localDb)
+	ui.migrationsView = components.NewMigrationsView(gui, localDb, ui.onMigrate, ui.logsView.AddLog)
 	ui.environmentsView = components.NewEnvironmentsView(gui, cfg, ui.onEnvironmentSelected)
+	ui.dumpsView = components.NewDumpsView(gui, dumps, ui.onDumpSelected, ui.logsView.AddLog)
+	ui.containerView = components.NewContainerView(gui, ui.GetCurrentEnvironment, containerStatus, ui.onContainerAction, ui.logsView.AddLog)
+	ui.progressView = components.NewProgressView(gui)
+	ui.jobsView = components.NewJobsView(gui, ui.queue, ui.logsView.AddLog)
 
 	// Add components to layout
 	ui.mainLayout.AddComponent(ui.connectionView)
 	ui.mainLayout.AddComponent(ui.migrationsView)
 	ui.mainLayout.AddComponent(ui.logsView)
 	ui.mainLayout.AddComponent(ui.environmentsView)
+	ui.mainLayout.AddComponent(ui.progressView)
+	ui.mainLayout.AddComponent(ui.dumpsView)
+	ui.mainLayout.AddComponent(ui.containerView)
+	ui.mainLayout.AddComponent(ui.jobsView)
 
 	// Set up GUI manager AFTER components are initialized
 	gui.SetManager(ui.mainLayout)
 	gui.Cursor = true
 	gui.Mouse = true
+	gui.InputEsc = true // Esc closes dialogs
 
 	// Set up global keybindings
 	ui.keybindings = keybindings.NewGlobalKeybindings(
 		gui,
 		func() error { return gocui.ErrQuit },
 		func() error { return ui.handleDump() },
-		func() error { return ui.handleLoad() },
+		func() error { return ui.handleLoad("") },
+		func() error { return ui.handleCopy() },
+		func() error { return ui.handleRefresh() },
 		func() error { return ui.handleShowEnvironments() },
+		func() error { return ui.handleShowDumps() },
+		func() error { return ui.handleShowContainer() },
+		func() error { return ui.handleShowJobs() },
+		func() error { return ui.handleAbort() },
 	)
 
 	if err := ui.keybindings.Setup(); err != nil {
@@ -75,7 +125,7 @@ func New(cfg *app.Config, localDb *db.Connection, onDump, onLoad func() error) (
 	}
 
 	// Update commands bar
-	ui.mainLayout.UpdateCommandsBar(" Space - Select Environment | d - Dump Database | l - Load Database | q/Ctrl+C - Quit")
+	ui.mainLayout.UpdateCommandsBar(commandsHelp)
 
 	// Select first environment by default
 	environments := cfg.GetEnvironments()
@@ -86,21 +136,41 @@ func New(cfg *app.Config, localDb *db.Connection, onDump, onLoad func() error) (
 	return ui, nil
 }
 
-// Run starts the UI main loop
+// Run starts the UI main loop. After quit, unfinished jobs are cancelled and waited for,
+// so that an aborted dump or load cleans up after itself before the process exits.
 func (ui *UI) Run() error {
-	defer ui.gui.Close()
-	return ui.gui.MainLoop()
+	err := ui.gui.MainLoop()
+	ui.gui.Close()
+	ui.stopJobs()
+	return err
+}
+
+// stopJobs cancels queued and running jobs and waits for the running ones to finish
+func (ui *UI) stopJobs() {
+	running := ui.queue.CancelAll()
+	if len(running) == 0 {
+		return
+	}
+
+	for _, job := range running {
+		fmt.Printf("Stopping %s...\n", job.Name)
+	}
+	ui.queue.Wait()
+	for _, job := range running {
+		fmt.Printf("Job %s stopped: %v\n", job.Name, job.Err())
+	}
 }
 
 // Event handlers
 func (ui *UI) onEnvironmentSelected(env *env.Environment) {
-	ui.localDb.Database = env.Name
+	*ui.localDb = *ui.cfg.LocalConnection(env)
 	ui.connectionView.SetCurrentEnvironment(env)
 	ui.migrationsView.SetCurrentEnvironment(env)
+	ui.dumpsView.SetCurrentEnvironment(env)
 	ui.logsView.AddLog("Selected environment: %s", env.Name)
 
 	// Update commands bar
-	ui.mainLayout.UpdateCommandsBar(" Space - Select Environment | d - Dump Database | l - Load Database | q/Ctrl+C - Quit")
+	ui.mainLayout.UpdateCommandsBar(commandsHelp)
 }
 
 func (ui *UI) GetCurrentEnvironment() *env.Environment {
@@ -112,6 +182,29 @@ func (ui *UI) handleShowEnvironments() error {
 	return nil
 }
 
+func (ui *UI) handleShowDumps() error {
+	ui.dumpsView.Show()
+	return nil
+}
+
+func (ui *UI) handleShowContainer() error {
+	if ui.GetCurrentEnvironment() == nil {
+		ui.logsView.AddLog("No environment selected")
+		return nil
+	}
+	ui.containerView.Show()
+	return nil
+}
+
+func (ui *UI) handleShowJobs() error {
+	ui.jobsView.Show()
+	return nil
+}
+
+func (ui *UI) onDumpSelected(dumpID string) {
+	ui.handleLoad(dumpID)
+}
+
 func (ui *UI) handleDump() error {
 	env := ui.GetCurrentEnvironment()
 	if env == nil {
@@ -119,31 +212,190 @@ func (ui *UI) handleDump() error {
 		return nil
 	}
 
-	if err := ui.onDump(); err != nil {
-		ui.logsView.AddLog("Error: %v", err)
-		return err
+	ui.EnqueueDump(env)
+	return nil
+}
+
+func (ui *UI) handleLoad(dumpID string) error {
+	env := ui.GetCurrentEnvironment()
+	if env == nil {
+		ui.logsView.AddLog("No environment selected")
+		return nil
 	}
-	ui.logsView.AddLog("Database dump completed successfully!")
 
+	ui.EnqueueLoad(env, dumpID)
 	return nil
 }
 
-func (ui *UI) handleLoad() error {
+func (ui *UI) handleCopy() error {
 	env := ui.GetCurrentEnvironment()
 	if env == nil {
 		ui.logsView.AddLog("No environment selected")
 		return nil
 	}
 
-	ui.logsView.AddLog("Loading dump into local database...")
-	if err := ui.onLoad(); err != nil {
-		ui.logsView.AddLog("Error: %v", err)
+	ui.EnqueueCopy(env)
+	return nil
+}
+
+func (ui *UI) handleRefresh() error {
+	env := ui.GetCurrentEnvironment()
+	if env == nil {
+		ui.logsView.AddLog("No environment selected")
 		return nil
 	}
-	ui.logsView.AddLog("Dump loaded successfully!")
+
+	ui.EnqueueRefresh(env)
+	return nil
+}
+
+func (ui *UI) onMigrate(targetVersion int64) {
+	if env := ui.GetCurrentEnvironment(); env != nil {
+		ui.EnqueueMigrate(env, targetVersion)
+	}
+}
+
+func (ui *UI) onContainerAction(action database.ContainerAction) error {
+	env := ui.GetCurrentEnvironment()
+	if env == nil {
+		return fmt.Errorf("environment not selected")
+	}
+
+	ui.EnqueueContainerAction(env, action)
 	return nil
 }
 
+// handleAbort cancels running jobs of the current environment
+func (ui *UI) handleAbort() error {
+	env := ui.GetCurrentEnvironment()
+	if env == nil {
+		return nil
+	}
+	for _, job := range ui.queue.Running(env.Name) {
+		ui.logsView.AddLog("Aborting %s...", job.Name)
+		ui.queue.Cancel(job)
+	}
+	return nil
+}
+
+// localTarget returns the local server of the environment. Jobs using the same server,
+// e.g. loads of two environments into the shared container, wait for each other.
+func (ui *UI) localTarget(e *env.Environment) string {
+	return ui.cfg.GetLocal(e).Target()
+}
+
+// EnqueueDump queues a dump of the environment
+func (ui *UI) EnqueueDump(e *env.Environment) *jobs.Job {
+	return ui.queue.Add("dump "+e.Name, e.Name, "", true, func(ctx context.Context, job *jobs.Job) error {
+		err := ui.onDump(ctx, job, e)
+		ui.Do(ui.dumpsView.Refresh)
+		return err
+	})
+}
+
+// EnqueueLoad queues a load of the dump into the environment's local database,
+// empty dumpID loads the latest dump
+func (ui *UI) EnqueueLoad(e *env.Environment, dumpID string) *jobs.Job {
+	return ui.queue.Add("load "+e.Name, e.Name, ui.localTarget(e), true, func(ctx context.Context, job *jobs.Job) error {
+		err := ui.onLoad(ctx, job, e, dumpID)
+		ui.Do(ui.migrationsView.Refresh)
+		return err
+	})
+}
+
+// EnqueueCopy queues a copy of the environment's database into its local database,
+// streamed without a dump file
+func (ui *UI) EnqueueCopy(e *env.Environment) *jobs.Job {
+	return ui.queue.Add("copy "+e.Name, e.Name, ui.localTarget(e), true, func(ctx context.Context, job *jobs.Job) error {
+		err := ui.onCopy(ctx, job, e)
+		ui.Do(ui.migrationsView.Refresh)
+		return err
+	})
+}
+
+// EnqueueRefresh queues the refresh pipeline of the environment
+func (ui *UI) EnqueueRefresh(e *env.Environment) *jobs.Job {
+	return ui.queue.Add("refresh "+e.Name, e.Name, ui.localTarget(e), true, func(ctx context.Context, job *jobs.Job) error {
+		err := ui.onRefresh(ctx, job, e)
+		ui.Do(func() {
+			ui.dumpsView.Refresh()
+			ui.migrationsView.Refresh()
+		})
+		return err
+	})
+}
+
+// EnqueueMigrate queues a migration of the environment's local database to the version
+func (ui *UI) EnqueueMigrate(e *env.Environment, targetVersion int64) *jobs.Job {
+	name := fmt.Sprintf("migrate %s to %d", e.Name, targetVersion)
+	ui.migrationsView.SetMigrating(true)
+	return ui.queue.Add(name, e.Name, ui.localTarget(e), false, func(ctx context.Context, job *jobs.Job) error {
+		// Not ui.localDb, another environment may have been selected meanwhile
+		err := migrations.MigrateTo(ctx, ui.cfg.LocalConnection(e).GetDSN(), e.MigrationsDir, targetVersion, job.Logf)
+		ui.Do(func() { ui.migrationsView.SetMigrating(false) })
+		return err
+	})
+}
+
+// EnqueueContainerAction queues a lifecycle action on the environment's local container
+func (ui *UI) EnqueueContainerAction(e *env.Environment, action database.ContainerAction) *jobs.Job {
+	name := fmt.Sprintf("%s container of %s", action, e.Name)
+	return ui.queue.Add(name, e.Name, ui.localTarget(e), false, func(ctx context.Context, job *jobs.Job) error {
+		err := ui.onContainer(job, e, action)
+		ui.Do(ui.containerView.Refresh)
+		return err
+	})
+}
+
+// onJobChanged updates the progress panel when jobs start and finish,
+// it is called from the jobs' goroutines
+func (ui *UI) onJobChanged(job *jobs.Job) {
+	ui.gui.Update(func(g *gocui.Gui) error {
+		ui.updateProgress()
+		if !ui.ticking && len(ui.queue.Running("")) > 0 {
+			ui.ticking = true
+			go ui.tick()
+		}
+		return nil
+	})
+}
+
+// updateProgress shows progress of the first running dump or load
+func (ui *UI) updateProgress() {
+	for _, job := range ui.queue.Running("") {
+		if progress := job.Progress(); progress != nil {
+			if job != ui.progressJob {
+				ui.progressJob = job
+				ui.progressView.Show(fmt.Sprintf("#%d %s", job.ID, job.Name), progress)
+			}
+			return
+		}
+	}
+	if ui.progressJob != nil {
+		ui.progressJob = nil
+		ui.progressView.Hide()
+	}
+}
+
+// tick redraws the progress and jobs panels while jobs run
+func (ui *UI) tick() {
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+	for range ticker.C {
+		stopped := make(chan bool, 1)
+		ui.gui.Update(func(g *gocui.Gui) error {
+			if len(ui.queue.Running("")) == 0 {
+				ui.ticking = false
+			}
+			stopped <- !ui.ticking
+			return nil
+		})
+		if <-stopped {
+			return
+		}
+	}
+}
+
 // Update forces an immediate UI update and waits for it to complete
 func (ui *UI) Update() {
 	done := make(chan struct{})
@@ -161,6 +413,14 @@ func (ui *UI) ForceRedraw() {
 	})
 }
 
+// Do runs f in the main loop, e.g. to change state shown by the views from a background operation
+func (ui *UI) Do(f func()) {
+	ui.gui.Update(func(g *gocui.Gui) error {
+		f()
+		return nil
+	})
+}
+
 // AddLog adds a log message to the logs view
 func (ui *UI) AddLog(format string, a ...interface{}) {
 	ui.logsView.AddLog(format, a...)
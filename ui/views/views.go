@@ -8,11 +8,16 @@ const (
 	ConnectionView   = "connection"
 	StatusView       = "status"
 	CommandsView     = "commands"
+	DumpsView        = "dumps"
+	ContainerView    = "container"
+	ProgressView     = "progress"
+	JobsView         = "jobs"
 
 	// Dialog views
 	ConfirmDialogView = "confirm-dialog"
 	ConfirmButtonView = "confirm-button"
 	CancelButtonView  = "cancel-button"
+	DumpRenameView    = "dump-rename"
 )
 
 // Component represents a UI component that can be laid out